@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// callUsage explains the arguments of the call command
+const callUsage = "Usage: lp-api call resource operation key=value... such as `lp-api call ubuntu searchTasks status=New` or `lp-api call bugs/1 newMessage content=Thanks`."
+
+// findCallOperation finds a named operation of a resource type whatever its HTTP method
+func findCallOperation(rt *ResourceType, name string) (*Operation, error) {
+	if op := rt.Operation(name); op != nil {
+		return op, nil
+	}
+	var names []string
+	for _, op := range rt.Operations {
+		names = append(names, op.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("There is no named operation on %s.", rt.Name)
+	}
+	return nil, fmt.Errorf("There is no '%s' named operation on %s.%s", name, rt.Name, didYouMean(name, names))
+}
+
+// callQueryArgs turns a key:=json argument of a GET operation into query parameters. A JSON list repeats the parameter.
+func callQueryArgs(key string, value string) ([]string, error) {
+	v, err := parseJSONParam(key, value)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	var args []string
+	for _, item := range values {
+		text, err := jsonFormValue(item)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, key+"=="+text)
+	}
+	return args, nil
+}
+
+// CallArgs converts key=value arguments into the arguments of Get or Post for a named operation,
+// using the types of its parameters: numbers and booleans are sent as typed values, binary
+// parameters as file uploads and the shorthand references of link parameters are expanded.
+// key:=json is passed as it is.
+func (lp *LaunchpadAPI) CallArgs(op *Operation, args []string) ([]string, error) {
+	separator := "="
+	if op.Method == "GET" {
+		separator = "=="
+	}
+	converted := []string{"ws.op" + separator + op.Name}
+	for _, arg := range args {
+		fields := strings.SplitN(arg, "=", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[0] == ":" {
+			return nil, fmt.Errorf("Invalid argument '%s'. %s", arg, callUsage)
+		}
+		key, value := fields[0], fields[1]
+
+		if strings.HasSuffix(key, ":") {
+			key = strings.TrimSuffix(key, ":")
+			if op.Method != "GET" {
+				converted = append(converted, arg)
+				continue
+			}
+			query, err := callQueryArgs(key, value)
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, query...)
+			continue
+		}
+
+		typ := "string"
+		if param := op.Param(key); param != nil {
+			typ = param.Type
+		}
+		if typ == "link" {
+			link, err := lp.linkValue(value)
+			if err != nil {
+				return nil, err
+			}
+			value = link
+		}
+		switch {
+		case op.Method == "GET":
+			converted = append(converted, key+"=="+value)
+		case typ == "int" || typ == "float" || typ == "boolean":
+			if !json.Valid([]byte(value)) {
+				return nil, fmt.Errorf("'%s' expects a %s, not '%s'.", key, typ, value)
+			}
+			converted = append(converted, key+":="+value)
+		case typ == "binary" && !strings.HasPrefix(value, "@"):
+			converted = append(converted, key+"=@"+value)
+		default:
+			converted = append(converted, key+"="+value)
+		}
+	}
+	return converted, nil
+}
+
+// Call sends the named operation of the resource with the HTTP method the WADL tells.
+// The entry created by a factory operation is fetched from the Location header of the response.
+func (lp *LaunchpadAPI) Call(resource string, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New(callUsage)
+	}
+	w, err := lp.LoadWADL()
+	if err != nil {
+		return "", err
+	}
+	types, err := lp.targetTypes(w, resource, args[0])
+	if err != nil {
+		return "", err
+	}
+	op, err := findCallOperation(types[0], args[0])
+	if err != nil {
+		return "", err
+	}
+	callArgs, err := lp.CallArgs(op, args[1:])
+	if err != nil {
+		return "", err
+	}
+	if *debug {
+		log.Print("CALL ", op.Method, " ", resource, " ", callArgs)
+	}
+
+	if op.Method == "GET" {
+		return lp.Get(resource, callArgs)
+	}
+	req, err := lp.PostRequest(resource, callArgs)
+	if err != nil {
+		return "", err
+	}
+	payload, resp, err := lp.DoRequest(req)
+	if err != nil {
+		return payload, err
+	}
+	if location := createdLocation(resp); location != "" {
+		if *debug {
+			log.Print("Created ", location)
+		}
+		return lp.getInternal(location)
+	}
+	return payload, nil
+}
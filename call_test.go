@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallArgs(t *testing.T) {
+	w := loadTestWADL(t)
+	newMessage := w.ResourceType("bug").Operation("newMessage")
+	addAttachment := w.ResourceType("bug").Operation("addAttachment")
+	searchTasks := w.ResourceType("distribution").Operation("searchTasks")
+	rescore := w.ResourceType("build").Operation("rescore")
+	isUserAffected := w.ResourceType("bug").Operation("isUserAffected")
+	markAsDuplicate := w.ResourceType("bug").Operation("markAsDuplicate")
+
+	tests := []struct {
+		name    string
+		op      *Operation
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"GET", searchTasks, []string{"status=New", "tags_combinator=All"}, []string{"ws.op==searchTasks", "status==New", "tags_combinator==All"}, false},
+		{"GET list", searchTasks, []string{`status:=["New","Triaged"]`}, []string{"ws.op==searchTasks", "status==New", "status==Triaged"}, false},
+		{"POST string", newMessage, []string{"content=Thanks", "subject=Re: crash"}, []string{"ws.op=newMessage", "content=Thanks", "subject=Re: crash"}, false},
+		{"POST value with =", newMessage, []string{"content=a=b"}, []string{"ws.op=newMessage", "content=a=b"}, false},
+		{"POST int", rescore, []string{"score=2000"}, []string{"ws.op=rescore", "score:=2000"}, false},
+		{"POST invalid int", rescore, []string{"score=high"}, nil, true},
+		{"POST boolean and file", addAttachment, []string{"data=crash.log", "is_patch=false", "comment=Log"}, []string{"ws.op=addAttachment", "data=@crash.log", "is_patch:=false", "comment=Log"}, false},
+		{"POST typed", newMessage, []string{`content:="Thanks"`}, []string{"ws.op=newMessage", `content:="Thanks"`}, false},
+		{"missing value", newMessage, []string{"content"}, nil, true},
+		// user is a link in the WADL although the name doesn't tell it
+		{"GET link", isUserAffected, []string{"user=~alice"}, []string{"ws.op==isUserAffected", "user==" + lpAPI + "~alice"}, false},
+		{"POST link", markAsDuplicate, []string{"duplicate_of=bugs/2"}, []string{"ws.op=markAsDuplicate", "duplicate_of=" + lpAPI + "bugs/2"}, false},
+		{"POST absolute link", markAsDuplicate, []string{"duplicate_of=" + lpAPI + "bugs/3"}, []string{"ws.op=markAsDuplicate", "duplicate_of=" + lpAPI + "bugs/3"}, false},
+	}
+	lp := LaunchpadAPI{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lp.CallArgs(tt.op, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CallArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CallArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	var requests []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Form.Encode())
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/devel/bugs/1":
+			w.Write([]byte(`{"id": 1, "resource_type_link": "https://api.launchpad.net/devel/#bug"}`))
+		case r.Method == "GET" && r.URL.Path == "/devel/ubuntu" && r.Form.Get("ws.op") == "":
+			w.Write([]byte(`{"name": "ubuntu", "resource_type_link": "https://api.launchpad.net/devel/#distribution"}`))
+		case r.Method == "GET" && r.URL.Path == "/devel/ubuntu":
+			w.Write([]byte(`{"total_size": 0, "entries": []}`))
+		case r.Method == "POST" && r.URL.Path == "/devel/bugs/1":
+			w.Header().Set("Location", server.URL+"/devel/bugs/1/messages/2")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "GET" && r.URL.Path == "/devel/bugs/1/messages/2":
+			w.Write([]byte(`{"content": "Thanks"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	backup := lpAPI
+	lpAPI = server.URL + "/devel/"
+	loadedWADL[lpAPI] = loadTestWADL(t)
+	t.Cleanup(func() {
+		delete(loadedWADL, lpAPI)
+		lpAPI = backup
+	})
+
+	lp := LaunchpadAPI{}
+	payload, err := lp.Call(lpAPI+"bugs/1", []string{"newMessage", "content=Thanks"})
+	if err != nil {
+		t.Fatalf("Call(newMessage) error = %v", err)
+	}
+	if payload != `{"content": "Thanks"}` {
+		t.Errorf("Call(newMessage) = %q, want the created message", payload)
+	}
+	want := []string{
+		"POST /devel/bugs/1 content=Thanks&ws.op=newMessage",
+		"GET /devel/bugs/1/messages/2 ",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+
+	// A string parameter read from a file is sent as text, not as an upload
+	file := filepath.Join(t.TempDir(), "comment.txt")
+	if err := os.WriteFile(file, []byte("Fixed upstream"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	requests = nil
+	if _, err := lp.Call(lpAPI+"bugs/1", []string{"newMessage", "content=@" + file}); err != nil {
+		t.Fatalf("Call(newMessage content=@file) error = %v", err)
+	}
+	if got := requests[0]; got != "POST /devel/bugs/1 content=Fixed+upstream&ws.op=newMessage" {
+		t.Errorf("Call(newMessage content=@file) sent %q", got)
+	}
+
+	requests = nil
+	if _, err := lp.Call(lpAPI+"ubuntu", []string{"searchTasks", "status=New"}); err != nil {
+		t.Fatalf("Call(searchTasks) error = %v", err)
+	}
+	if got := requests[len(requests)-1]; got != "GET /devel/ubuntu status=New&ws.op=searchTasks" {
+		t.Errorf("Call(searchTasks) sent %q", got)
+	}
+
+	if _, err := lp.Call(lpAPI+"ubuntu", []string{"serachTasks"}); err == nil || !strings.Contains(err.Error(), "Did you mean 'searchTasks'?") {
+		t.Errorf("Call(serachTasks) error = %v", err)
+	}
+	if _, err := lp.Call(lpAPI+"ubuntu", nil); err == nil || !strings.Contains(err.Error(), "Usage") {
+		t.Errorf("Call() without an operation error = %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// cassetteRequest is a request saved in a cassette
+type cassetteRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"`
+	// BodyTooLarge tells that the body was larger than maxCassetteBody and isn't saved
+	BodyTooLarge bool `json:"body_too_large,omitempty"`
+}
+
+// cassetteResponse is the response saved for a request
+type cassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"`
+}
+
+// interaction is a request and its response
+type interaction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+// cassette is the file of -record and -replay
+type cassette struct {
+	path      string
+	recording bool
+	// Note tells where the interactions come from, such as a recording or a fixture written by hand
+	Note         string         `json:"note,omitempty"`
+	Interactions []*interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	used map[*interaction]bool
+}
+
+// cassettes are opened once per file, because several clients share them
+var cassettes = struct {
+	sync.Mutex
+	files map[string]*cassette
+}{files: make(map[string]*cassette)}
+
+// openCassette returns the cassette at path, read from the file unless it is being recorded
+func openCassette(path string, recording bool) (*cassette, error) {
+	cassettes.Lock()
+	defer cassettes.Unlock()
+	if c, ok := cassettes.files[path]; ok {
+		return c, nil
+	}
+	c := &cassette{path: path, recording: recording, used: make(map[*interaction]bool)}
+	if !recording {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the cassette: %v", err)
+		}
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("Invalid cassette %s: %v", path, err)
+		}
+	}
+	cassettes.files[path] = c
+	return c, nil
+}
+
+// secretField matches the secrets of the OAuth token requests and responses
+var secretField = regexp.MustCompile(`(oauth_signature|oauth_token_secret)=[^&\s]*`)
+
+// redactSecrets hides the OAuth secrets in a body
+func redactSecrets(body []byte) []byte {
+	return secretField.ReplaceAll(body, []byte("$1=REDACTED"))
+}
+
+// setBody stores a body as text, or as base64 when it is binary
+func setBody(text *string, binary *[]byte, body []byte) {
+	if utf8.Valid(body) {
+		*text = string(body)
+	} else {
+		*binary = body
+	}
+}
+
+// getBody returns a body stored by setBody
+func getBody(text string, binary []byte) []byte {
+	if binary != nil {
+		return binary
+	}
+	return []byte(text)
+}
+
+// normalizeBody makes the bodies of equivalent requests equal: form values are sorted, JSON is
+// compacted with sorted keys and the random boundary and part headers of multipart bodies are dropped
+func normalizeBody(contentType string, body []byte) string {
+	body = redactSecrets(body)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return string(body)
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return values.Encode()
+		}
+	case "application/json":
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			if data, err := json.Marshal(v); err == nil {
+				return string(data)
+			}
+		}
+	case "multipart/form-data":
+		var buf bytes.Buffer
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return buf.String()
+			}
+			if err != nil {
+				break
+			}
+			content, err := io.ReadAll(part)
+			if err != nil {
+				break
+			}
+			fmt.Fprintf(&buf, "%s;%s\n%s\n", part.FormName(), part.FileName(), content)
+		}
+	}
+	return string(body)
+}
+
+// maxCassetteBody is the size of the largest request body kept in memory and saved in a cassette.
+// Larger ones, such as uploaded files, are streamed as usual and only their method and URL are matched.
+const maxCassetteBody = 1 << 20
+
+// readCassetteBody reads the body of req when it is no larger than maxCassetteBody. A larger body isn't
+// returned, tooLarge is true and req gets a body streaming what was read followed by the rest.
+func readCassetteBody(req *http.Request) (body []byte, tooLarge bool, err error) {
+	if req.Body == nil {
+		return nil, false, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(req.Body, maxCassetteBody+1))
+	if err != nil {
+		req.Body.Close()
+		return nil, false, err
+	}
+	if len(body) > maxCassetteBody {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, true, nil
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, false, nil
+}
+
+// matches tells whether the saved request is the same as req with body, ignoring the host.
+// Bodies too large to be saved aren't compared.
+func (r *cassetteRequest) matches(req *http.Request, body []byte, tooLarge bool) bool {
+	if r.Method != req.Method {
+		return false
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Path != req.URL.Path || u.Query().Encode() != req.URL.Query().Encode() {
+		return false
+	}
+	if r.BodyTooLarge || tooLarge {
+		return r.BodyTooLarge == tooLarge
+	}
+	return normalizeBody(r.Header.Get("Content-Type"), getBody(r.Body, r.BodyBase64)) == normalizeBody(req.Header.Get("Content-Type"), body)
+}
+
+// find returns the first unused interaction matching the request, or the last matching one
+// when they are all used, so that repeated requests get the answers in the recorded order
+func (c *cassette) find(req *http.Request, body []byte, tooLarge bool) *interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var last *interaction
+	for _, i := range c.Interactions {
+		if !i.Request.matches(req, body, tooLarge) {
+			continue
+		}
+		if !c.used[i] {
+			c.used[i] = true
+			return i
+		}
+		last = i
+	}
+	return last
+}
+
+// add appends an interaction to the cassette, which is written by saveCassettes
+func (c *cassette) add(i *interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+// save writes the cassette to its file
+func (c *cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0600)
+}
+
+// saveCassettes writes the cassettes recorded with -record. It is called once when the run ends,
+// including when lp-api exits on an error, so that the failed request is saved too.
+func saveCassettes() error {
+	cassettes.Lock()
+	defer cassettes.Unlock()
+	for _, c := range cassettes.files {
+		if !c.recording {
+			continue
+		}
+		if err := c.save(); err != nil {
+			return fmt.Errorf("Failed to save the cassette: %v", err)
+		}
+	}
+	return nil
+}
+
+// redactedHeader returns a copy of the header without credentials and cookies
+func redactedHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			if name == "Set-Cookie" {
+				value = "REDACTED"
+			}
+			redacted.Add(name, redactHeader(name, value))
+		}
+	}
+	return redacted
+}
+
+// cassetteTransport records the requests to a cassette or answers them from it
+type cassetteTransport struct {
+	path      string
+	recording bool
+	next      http.RoundTripper
+}
+
+// withCassette returns the transport of -record or -replay around next, or next itself to send the requests as usual
+func withCassette(next http.RoundTripper) http.RoundTripper {
+	switch {
+	case *record != "":
+		return &cassetteTransport{path: *record, recording: true, next: next}
+	case *replay != "":
+		return &cassetteTransport{path: *replay, next: next}
+	}
+	return next
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if *record != "" && *replay != "" {
+		return nil, errors.New("-record and -replay can't be used together.")
+	}
+	c, err := openCassette(t.path, t.recording)
+	if err != nil {
+		return nil, err
+	}
+	body, tooLarge, err := readCassetteBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.recording {
+		i := c.find(req, body, tooLarge)
+		if i == nil && !*strict {
+			return t.next.RoundTrip(req)
+		}
+		// The body of a request answered from the cassette isn't sent
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		if i == nil {
+			return nil, fmt.Errorf("There is no %s %s in the cassette %s.", req.Method, req.URL, t.path)
+		}
+		return i.Response.response(req), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	i := &interaction{
+		Request:  cassetteRequest{Method: req.Method, URL: req.URL.String(), Header: redactedHeader(req.Header), BodyTooLarge: tooLarge},
+		Response: cassetteResponse{StatusCode: resp.StatusCode, Header: redactedHeader(resp.Header)},
+	}
+	setBody(&i.Request.Body, &i.Request.BodyBase64, redactSecrets(body))
+	setBody(&i.Response.Body, &i.Response.BodyBase64, redactSecrets(respBody))
+	c.add(i)
+	return resp, nil
+}
+
+// response builds the HTTP response of a saved interaction
+func (r *cassetteResponse) response(req *http.Request) *http.Response {
+	body := getBody(r.Body, r.BodyBase64)
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
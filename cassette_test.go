@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		a, b        string
+		equal       bool
+	}{
+		{"form order", "application/x-www-form-urlencoded", "ws.op=newMessage&content=Thanks", "content=Thanks&ws.op=newMessage", true},
+		{"form value", "application/x-www-form-urlencoded", "content=Thanks", "content=Thank+you", false},
+		{"form secret", "application/x-www-form-urlencoded", "oauth_signature=%26secret", "oauth_signature=REDACTED", true},
+		{"JSON spacing", "application/json", `{"tags": [], "title": "Crash"}`, `{"title":"Crash","tags":[]}`, true},
+		{"JSON value", "application/json", `{"tags":[]}`, `{"tags":["focal"]}`, false},
+		{"multipart boundary", "multipart/form-data; boundary=", "--B\r\nContent-Disposition: form-data; name=\"data\"; filename=\"a.log\"\r\nContent-Type: text/plain\r\n\r\nlog\r\n--B--\r\n", "--C\r\nContent-Disposition: form-data; name=\"data\"; filename=\"a.log\"\r\nContent-Type: text/x-log\r\n\r\nlog\r\n--C--\r\n", true},
+		{"multipart content", "multipart/form-data; boundary=", "--B\r\nContent-Disposition: form-data; name=\"comment\"\r\n\r\nLog\r\n--B--\r\n", "--C\r\nContent-Disposition: form-data; name=\"comment\"\r\n\r\nCore\r\n--C--\r\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typeA, typeB := tt.contentType, tt.contentType
+			if strings.HasSuffix(tt.contentType, "boundary=") {
+				typeA, typeB = tt.contentType+"B", tt.contentType+"C"
+			}
+			a, b := normalizeBody(typeA, []byte(tt.a)), normalizeBody(typeB, []byte(tt.b))
+			if (a == b) != tt.equal {
+				t.Errorf("normalizeBody() = %q and %q, want equal %v", a, b, tt.equal)
+			}
+		})
+	}
+}
+
+func TestCassette(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Set-Cookie", "session=abc")
+			w.Write([]byte(`{"id": 1}`))
+		case "POST":
+			w.Header().Set("Location", "http://"+r.Host+"/devel/bugs/1/messages/"+r.Form.Get("content"))
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	backupRecord, backupReplay, backupStrict := *record, *replay, *strict
+	t.Cleanup(func() {
+		*record, *replay, *strict = backupRecord, backupReplay, backupStrict
+		delete(cassettes.files, file)
+	})
+
+	lp := LaunchpadAPI{Credential: Credential{Key: "lp-api", Token: "token", Secret: "secret"}}
+	send := func() []string {
+		get, err := lp.Get(server.URL+"/devel/bugs/1", []string{"ws.show==all"})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		first, err := lp.Post(server.URL+"/devel/bugs/1", []string{"ws.op=newMessage", "content=1"})
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		second, err := lp.Post(server.URL+"/devel/bugs/1", []string{"content=2", "ws.op=newMessage"})
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		return []string{get, strings.TrimPrefix(first, server.URL), strings.TrimPrefix(second, server.URL)}
+	}
+
+	*record = file
+	recorded := send()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the cassette was written before the end of the run: %v", err)
+	}
+	if err := saveCassettes(); err != nil {
+		t.Fatalf("saveCassettes() error = %v", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read the cassette: %v", err)
+	}
+	for _, secret := range []string{"secret", `"token"`, "session=abc"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("The cassette contains %q:\n%s", secret, data)
+		}
+	}
+
+	// The cassette answers without the server
+	server.Close()
+	requests = 0
+	delete(cassettes.files, file)
+	*record, *replay, *strict = "", file, true
+	replayed := send()
+	for i := range recorded {
+		if replayed[i] != recorded[i] {
+			t.Errorf("replayed %q, want %q", replayed[i], recorded[i])
+		}
+	}
+	if requests != 0 {
+		t.Errorf("%d requests were sent while replaying", requests)
+	}
+
+	if _, err := lp.Get(server.URL+"/devel/bugs/2", nil); err == nil || !strings.Contains(err.Error(), "There is no GET") {
+		t.Errorf("Get() of a request missing from the cassette error = %v", err)
+	}
+}
+
+// roundTripFunc is a transport answering the requests with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCassette_largeBody(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	backupStrict := *strict
+	t.Cleanup(func() {
+		*strict = backupStrict
+		delete(cassettes.files, file)
+	})
+
+	var received int64
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		n, err := io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+		received = n
+		return &http.Response{StatusCode: http.StatusCreated, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("")), Request: req}, err
+	})
+	size := int64(maxCassetteBody + 4096)
+	upload := func(transport http.RoundTripper) error {
+		req, err := http.NewRequest("POST", "https://api.launchpad.net/devel/bugs/1", io.LimitReader(bytes.NewReader(make([]byte, size)), size))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=B")
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// A body larger than maxCassetteBody is sent whole but not saved
+	if err := upload(&cassetteTransport{path: file, recording: true, next: next}); err != nil {
+		t.Fatalf("recording error = %v", err)
+	}
+	if received != size {
+		t.Errorf("the server received %d bytes, want %d", received, size)
+	}
+	if err := saveCassettes(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > maxCassetteBody || !strings.Contains(string(data), `"body_too_large": true`) {
+		t.Errorf("the cassette has %d bytes, want the request saved without its body", len(data))
+	}
+
+	// It is answered from the cassette by its method and URL
+	delete(cassettes.files, file)
+	*strict = true
+	received = 0
+	if err := upload(&cassetteTransport{path: file, next: next}); err != nil {
+		t.Errorf("replay error = %v", err)
+	}
+	if received != 0 {
+		t.Errorf("the request was sent during the replay")
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// commands lists the subcommands offered by completion
+var commands = []string{"cache", "call", "completion", "delete", "describe", "download", "edit", "get", "mock-server", "patch", "post", "put", "url"}
+
+// completionShells lists the shells completion scripts are generated for
+var completionShells = []string{"bash", "fish", "zsh"}
+
+const bashCompletion = `# bash completion for lp-api, generated by ` + "`lp-api completion bash`" + `
+_lp_api() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        # COMP_WORDS is split at = as well, so split the line at spaces only
+        local line="${COMP_LINE:0:COMP_POINT}"
+        read -ra words <<< "$line"
+        [[ $line == *" " ]] && words+=("")
+        cword=$((${#words[@]} - 1))
+        cur="${words[cword]}"
+    fi
+    local IFS=$'\n'
+    local candidates=($(lp-api __complete "${words[@]:1:cword}" 2>/dev/null))
+    # Bash replaces only the part of the word after the last = or :
+    local prefix="${cur%"${cur##*[=:]}"}"
+    COMPREPLY=()
+    local candidate
+    for candidate in "${candidates[@]}"; do
+        [[ $candidate == *[=@] ]] && compopt -o nospace 2>/dev/null
+        COMPREPLY+=("$(printf '%q' "${candidate#"$prefix"}")")
+    done
+}
+complete -F _lp_api lp-api
+`
+
+const zshCompletion = `#compdef lp-api
+# zsh completion for lp-api, generated by ` + "`lp-api completion zsh`" + `
+_lp_api() {
+    local -a candidates partial complete
+    candidates=("${(@f)$(lp-api __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    local candidate
+    for candidate in $candidates; do
+        # Parameter names wait for their values
+        if [[ $candidate == *[=@] ]]; then
+            partial+=("$candidate")
+        else
+            complete+=("$candidate")
+        fi
+    done
+    compadd -S '' -- $partial
+    compadd -- $complete
+}
+# Autoloaded from $fpath the file is the completion function, sourced it registers one
+if [[ $funcstack[1] == _lp-api ]]; then
+    _lp_api "$@"
+else
+    compdef _lp_api lp-api
+fi
+`
+
+const fishCompletion = `# fish completion for lp-api, generated by ` + "`lp-api completion fish`" + `
+function __lp_api_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    lp-api __complete $tokens (commandline -ct) 2>/dev/null
+end
+complete -c lp-api -f -a '(__lp_api_complete)'
+`
+
+// CompletionScript returns the completion script for shell
+func CompletionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	case "fish":
+		return fishCompletion, nil
+	}
+	return "", errors.New("Usage: lp-api completion {" + strings.Join(completionShells, ",") + "}")
+}
+
+// takesValue checks if a command-line flag is followed by its value, as -output file is
+func takesValue(word string) bool {
+	name := strings.TrimLeft(word, "-")
+	if strings.Contains(name, "=") {
+		return false
+	}
+	f := flag.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+// flagNames returns the command-line flags as they are typed
+func flagNames() []string {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+// bugPath matches the path of a bug, such as bugs/123
+var bugPath = regexp.MustCompile(`^bugs/[0-9]+$`)
+
+// pathType guesses the resource type of a resource argument without asking Launchpad
+func pathType(w *WADL, arg string) *ResourceType {
+	path := strings.Trim(strings.TrimPrefix(arg, lpAPI), "/")
+	switch {
+	case path == "":
+		return w.ResourceType("service-root")
+	case bugPath.MatchString(path):
+		return w.ResourceType("bug")
+	case strings.HasPrefix(path, "~") && !strings.Contains(path, "/"):
+		return w.ResourceType("person")
+	}
+	if name, ok := w.Collections[path]; ok {
+		return w.ResourceType(name)
+	}
+	return nil
+}
+
+// operationNames returns the names of the operations sent with method, of rt or of every resource type when rt is nil
+func operationNames(w *WADL, rt *ResourceType, method string) []string {
+	types := []*ResourceType{rt}
+	if rt == nil {
+		types = nil
+		for _, name := range w.ResourceTypeNames() {
+			types = append(types, w.ResourceType(name))
+		}
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range types {
+		for _, op := range t.Operations {
+			if (method == "" || op.Method == method) && !seen[op.Name] {
+				seen[op.Name] = true
+				names = append(names, op.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findOperation finds the named operation sent with method on rt, or on any resource type when rt is nil
+func findOperation(w *WADL, rt *ResourceType, method string, name string) *Operation {
+	if rt != nil {
+		for _, op := range rt.Operations {
+			if op.Name == name && op.Method == method {
+				return op
+			}
+		}
+		return nil
+	}
+	for _, typeName := range w.ResourceTypeNames() {
+		if op := findOperation(w, w.ResourceType(typeName), method, name); op != nil {
+			return op
+		}
+	}
+	return nil
+}
+
+// completeParams completes the ws.op, parameter names and enum values of get and post
+func completeParams(w *WADL, method string, resource string, args []string, cur string) []string {
+	separator := "="
+	if method == "GET" {
+		separator = "=="
+	}
+	rt := pathType(w, resource)
+	wsOp := "ws.op" + separator
+
+	var candidates []string
+	if strings.HasPrefix(cur, wsOp) {
+		for _, name := range operationNames(w, rt, method) {
+			candidates = append(candidates, wsOp+name)
+		}
+		return candidates
+	}
+
+	var op *Operation
+	for _, arg := range args {
+		if strings.HasPrefix(arg, wsOp) {
+			op = findOperation(w, rt, method, strings.TrimPrefix(arg, wsOp))
+		}
+	}
+	if op == nil {
+		return []string{wsOp}
+	}
+	return completeOperationParams(op, separator, args, cur)
+}
+
+// completeOperationParams completes the parameter names of a named operation that are not given yet, or the enum values of one
+func completeOperationParams(op *Operation, separator string, args []string, cur string) []string {
+	used := make(map[string]bool)
+	for _, arg := range args {
+		if i := strings.Index(arg, separator); i > 0 {
+			used[arg[:i]] = true
+		}
+	}
+
+	var candidates []string
+	if i := strings.Index(cur, separator); i > 0 {
+		if param := op.Param(cur[:i]); param != nil {
+			for _, option := range param.Options {
+				candidates = append(candidates, param.Name+separator+option)
+			}
+		}
+		return candidates
+	}
+	for _, param := range op.Params {
+		if used[param.Name] {
+			continue
+		}
+		if param.Type == "binary" {
+			candidates = append(candidates, param.Name+"=@")
+		} else {
+			candidates = append(candidates, param.Name+separator)
+		}
+	}
+	return candidates
+}
+
+// completeWords returns the completions of the last word, given the words typed after lp-api.
+// w is the cached WADL of the service root, or nil when there is none yet.
+func completeWords(w *WADL, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	var args []string
+	typed := words[:len(words)-1]
+	for i := 0; i < len(typed); i++ {
+		if len(args) == 0 && strings.HasPrefix(typed[i], "-") {
+			if takesValue(typed[i]) {
+				i++
+			}
+			continue
+		}
+		args = append(args, typed[i])
+	}
+
+	var candidates []string
+	switch {
+	case len(args) == 0 && strings.HasPrefix(cur, "-"):
+		candidates = flagNames()
+	case len(args) == 0:
+		candidates = commands
+	case args[0] == "completion":
+		if len(args) == 1 {
+			candidates = completionShells
+		}
+	case args[0] == "cache":
+		if len(args) == 1 {
+			candidates = []string{"clear", "stats"}
+		}
+	case w == nil:
+	case len(args) == 1:
+		candidates = append(candidates, "people/+me")
+		for name := range w.Collections {
+			candidates = append(candidates, name)
+		}
+		if args[0] == "describe" {
+			for _, name := range w.ResourceTypeNames() {
+				if !strings.HasSuffix(name, "-page-resource") {
+					candidates = append(candidates, name)
+				}
+			}
+		}
+		sort.Strings(candidates)
+	case args[0] == "describe" && len(args) == 2:
+		rt := w.ResourceType(args[1])
+		if rt == nil {
+			rt = pathType(w, args[1])
+		}
+		if rt != nil {
+			candidates = operationNames(w, rt, "")
+		}
+	case args[0] == "call" && len(args) == 2:
+		candidates = operationNames(w, pathType(w, args[1]), "")
+	case args[0] == "call":
+		rt := pathType(w, args[1])
+		op := findOperation(w, rt, "GET", args[2])
+		if op == nil {
+			op = findOperation(w, rt, "POST", args[2])
+		}
+		if op != nil {
+			candidates = completeOperationParams(op, "=", args[3:], cur)
+		}
+	case args[0] == "get":
+		candidates = completeParams(w, "GET", args[1], args[2:], cur)
+	case args[0] == "post":
+		candidates = completeParams(w, "POST", args[1], args[2:], cur)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, cur) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// Complete returns the completions for the words typed after lp-api, using the cached WADL only
+func Complete(words []string) []string {
+	// The word being typed is left out, and -service-root wins over -staging as in main
+	root := ""
+	for i := 0; i < len(words)-1; i++ {
+		word := words[i]
+		name := strings.TrimLeft(word, "-")
+		switch {
+		case word == name:
+		case name == "staging":
+			lpAPI = "https://api.staging.launchpad.net/devel/"
+		case name == "service-root" && i+1 < len(words)-1:
+			i++
+			root = words[i]
+		case strings.HasPrefix(name, "service-root="):
+			root = strings.TrimPrefix(name, "service-root=")
+		}
+	}
+	if root != "" {
+		lpAPI = strings.TrimSuffix(root, "/") + "/"
+	}
+	w, err := CachedWADL()
+	if err != nil {
+		w = nil
+	}
+	return completeWords(w, words)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompleteWords(t *testing.T) {
+	w := loadTestWADL(t)
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{"subcommands", []string{"c"}, []string{"cache", "call", "completion"}},
+		{"more subcommands", []string{"d"}, []string{"delete", "describe", "download"}},
+		{"subcommands after flags", []string{"-staging", "-output", "bug.json", "g"}, []string{"get"}},
+		{"flags", []string{"-stag"}, []string{"-staging"}},
+		{"shells", []string{"completion", ""}, []string{"bash", "fish", "zsh"}},
+		{"collections", []string{"get", "b"}, []string{"bugs"}},
+		{"resource types", []string{"describe", "bug_"}, []string{"bug_task"}},
+		{"describe operations", []string{"describe", "bug", "n"}, []string{"newMessage"}},
+		{"ws.op first", []string{"get", "ubuntu", ""}, []string{"ws.op=="}},
+		{"GET operations of a bug", []string{"get", "bugs/1", "ws.op=="}, []string{"ws.op==isUserAffected"}},
+		{"POST operations of a bug", []string{"post", "bugs/1", "ws.op=m"}, []string{"ws.op=markAsDuplicate"}},
+		{"operations of an unknown resource", []string{"get", "ubuntu", "ws.op==se"}, []string{"ws.op==searchTasks"}},
+		{"parameters", []string{"post", "bugs/1", "ws.op=newMessage", ""}, []string{"content=", "subject="}},
+		{"unused parameters", []string{"post", "bugs/1", "ws.op=newMessage", "content=Thanks", ""}, []string{"subject="}},
+		{"file parameters", []string{"post", "bugs/1", "ws.op=addAttachment", "d"}, []string{"data=@", "description="}},
+		{"enum values", []string{"get", "ubuntu", "ws.op==searchTasks", "status==Fix"}, []string{"status==Fix Committed", "status==Fix Released"}},
+		{"call operations", []string{"call", "bugs/1", "m"}, []string{"markAsDuplicate"}},
+		{"call parameters", []string{"call", "ubuntu", "searchTasks", "tags_"}, []string{"tags_combinator="}},
+		{"call enum values", []string{"call", "ubuntu", "searchTasks", "tags_combinator=A"}, []string{"tags_combinator=Any", "tags_combinator=All"}},
+		{"arguments of other commands", []string{"patch", "bugs/1", "ti"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completeWords(w, tt.words); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completeWords(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+
+	// Without a cached WADL only subcommands are completed
+	if got := completeWords(nil, []string{"get", "bugs/1", "ws.op=="}); got != nil {
+		t.Errorf("completeWords() without WADL = %q", got)
+	}
+}
+
+func TestComplete_serviceRoot(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := "http://127.0.0.1:8080/devel/"
+	cachePath, err := wadlCachePath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("testdata/wadl-devel.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	backup := lpAPI
+	t.Cleanup(func() {
+		delete(loadedWADL, root)
+		lpAPI = backup
+	})
+
+	tests := [][]string{
+		{"-service-root", "http://127.0.0.1:8080/devel", "describe", "bug_"},
+		{"--service-root=http://127.0.0.1:8080/devel/", "describe", "bug_"},
+		{"-staging", "-service-root", "http://127.0.0.1:8080/devel/", "describe", "bug_"},
+	}
+	for _, words := range tests {
+		lpAPI = backup
+		if got := Complete(words); !reflect.DeepEqual(got, []string{"bug_task"}) {
+			t.Errorf("Complete(%q) = %q, want the types of the WADL cached for %s", words, got, root)
+		}
+		if lpAPI != root {
+			t.Errorf("Complete(%q) uses %s, want %s", words, lpAPI, root)
+		}
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range completionShells {
+		script, err := CompletionScript(shell)
+		if err != nil {
+			t.Fatalf("CompletionScript(%s) error = %v", shell, err)
+		}
+		if !strings.Contains(script, "lp-api __complete") {
+			t.Errorf("CompletionScript(%s) does not call lp-api __complete", shell)
+		}
+	}
+	if _, err := CompletionScript("tcsh"); err == nil {
+		t.Error("CompletionScript(tcsh) expected error")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+)
+
+// firstLine returns the first line of a documentation text
+func firstLine(doc string) string {
+	if i := strings.Index(doc, "\n"); i >= 0 {
+		return doc[:i]
+	}
+	return doc
+}
+
+// describeType explains the type of a field or parameter, such as "link → person"
+func describeType(typ string, linkType string) string {
+	if typ == "link" && linkType != "" {
+		return "link → " + strings.TrimSuffix(linkType, "-page-resource")
+	}
+	return typ
+}
+
+// usageLine shows how to invoke an operation with lp-api
+func usageLine(rt *ResourceType, op *Operation) string {
+	method := "post"
+	separator := "="
+	if op.Method == "GET" {
+		method = "get"
+		separator = "=="
+	}
+	words := []string{"lp-api", method, "<" + rt.Name + ">", "ws.op" + separator + op.Name}
+	for _, param := range op.Params {
+		value := param.Name + separator + "..."
+		if param.Type == "binary" {
+			value = param.Name + "=@file"
+		}
+		if !param.Required {
+			value = "[" + value + "]"
+		}
+		words = append(words, value)
+	}
+	return strings.Join(words, " ")
+}
+
+// DescribeType shows the fields, links, collections and named operations of a resource type
+func DescribeType(rt *ResourceType) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Resource type: %s\n", rt.Name)
+	if rt.Doc != "" {
+		fmt.Fprintf(&out, "%s\n", rt.Doc)
+	}
+	if rt.IsCollection() {
+		fmt.Fprintf(&out, "Collection of: %s\n", rt.Entries)
+	}
+
+	var fields, links, collections []*Field
+	for _, field := range rt.Fields {
+		switch {
+		case strings.HasSuffix(field.Name, "_collection_link"):
+			collections = append(collections, field)
+		case field.Type == "link":
+			if field.LinkType != "" {
+				links = append(links, field)
+			}
+		default:
+			fields = append(fields, field)
+		}
+	}
+
+	section := func(title string, list []*Field) {
+		if len(list) == 0 {
+			return
+		}
+		fmt.Fprintf(&out, "\n%s:\n", title)
+		tw := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+		for _, field := range list {
+			writable := " "
+			if field.Writable {
+				writable = "*"
+			}
+			fmt.Fprintf(tw, "  %s %s\t%s\t%s\n", writable, field.Name, describeType(field.Type, field.LinkType), firstLine(field.Doc))
+			if len(field.Options) > 0 {
+				fmt.Fprintf(tw, "\t\tone of: %s\n", strings.Join(field.Options, ", "))
+			}
+		}
+		tw.Flush()
+	}
+	section("Fields (* writable)", fields)
+	section("Links (* writable)", links)
+	section("Collections", collections)
+
+	for _, method := range []string{"GET", "POST"} {
+		var ops []*Operation
+		for _, op := range rt.Operations {
+			if op.Method == method {
+				ops = append(ops, op)
+			}
+		}
+		if len(ops) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "\n%s operations:\n", method)
+		tw := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+		for _, op := range ops {
+			var params []string
+			for _, param := range op.Params {
+				name := param.Name
+				if param.Required {
+					name += "*"
+				}
+				params = append(params, name)
+			}
+			fmt.Fprintf(tw, "  %s(%s)\t%s\n", op.Name, strings.Join(params, ", "), firstLine(op.Doc))
+		}
+		tw.Flush()
+	}
+	return out.String()
+}
+
+// DescribeOperation shows one named operation of a resource type in detail
+func DescribeOperation(rt *ResourceType, op *Operation) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s %s on %s\n", op.Method, op.Name, rt.Name)
+	if op.Doc != "" {
+		fmt.Fprintf(&out, "%s\n", op.Doc)
+	}
+	fmt.Fprintf(&out, "\nUsage: %s\n", usageLine(rt, op))
+
+	if len(op.Params) > 0 {
+		fmt.Fprintf(&out, "\nParameters (* required):\n")
+		tw := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+		for _, param := range op.Params {
+			required := " "
+			if param.Required {
+				required = "*"
+			}
+			fmt.Fprintf(tw, "  %s %s\t%s\t%s\n", required, param.Name, describeType(param.Type, param.LinkType), firstLine(param.Doc))
+			if len(param.Options) > 0 {
+				fmt.Fprintf(tw, "\t\tone of: %s\n", strings.Join(param.Options, ", "))
+			}
+		}
+		tw.Flush()
+	}
+
+	switch {
+	case op.Creates != "":
+		fmt.Fprintf(&out, "\nCreates: %s (its URL is in the Location header)\n", op.Creates)
+	case op.Returns != "" && op.ReturnsCollection:
+		fmt.Fprintf(&out, "\nReturns: collection of %s\n", op.Returns)
+	case op.Returns != "":
+		fmt.Fprintf(&out, "\nReturns: %s\n", op.Returns)
+	}
+	return out.String()
+}
+
+// ResourceTypeOf finds the resource type of a resource from the resource_type_link of its representation
+func (lp *LaunchpadAPI) ResourceTypeOf(w *WADL, resource string) (*ResourceType, error) {
+	payload, err := lp.getInternal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var representation map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &representation); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON resource: %v", resource, err)
+	}
+	rt := w.EntryType(representation)
+	if rt == nil {
+		return nil, fmt.Errorf("Unable to find the resource type of %s.", resource)
+	}
+	if *debug {
+		log.Print(resource, " is a ", rt.Name)
+	}
+	return rt, nil
+}
+
+// Describe shows the resource type named by arg, or the one of the resource at arg, and optionally one of its named operations
+func (lp *LaunchpadAPI) Describe(arg string, resource string, args []string) (string, error) {
+	w, err := lp.LoadWADL()
+	if err != nil {
+		return "", err
+	}
+	rt := w.ResourceType(arg)
+	if rt == nil {
+		rt, err = lp.ResourceTypeOf(w, resource)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(args) == 0 {
+		return DescribeType(rt), nil
+	}
+	op := rt.Operation(args[0])
+	if op == nil {
+		return "", fmt.Errorf("There is no '%s' named operation on %s.", args[0], rt.Name)
+	}
+	return DescribeOperation(rt, op), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDescribeType(t *testing.T) {
+	w := loadTestWADL(t)
+
+	got := DescribeType(w.ResourceType("bug"))
+	for _, want := range []string{
+		"Resource type: bug\nA bug.\n",
+		"  * title ",
+		"    id ",
+		"one of: Public, Public Security, Private Security, Private, Proprietary, Embargoed",
+		"link → person",
+		"bug_tasks_collection_link  link → bug_task",
+		"GET operations:\n  isUserAffected(user)",
+		"addAttachment(comment*, content_type, data*, description, filename*, is_patch)",
+		"newMessage(content*, subject)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DescribeType(bug) is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Collection of:") {
+		t.Errorf("DescribeType(bug) describes an entry as a collection:\n%s", got)
+	}
+
+	if got := DescribeType(w.ResourceType("bugs")); !strings.Contains(got, "Collection of: bug\n") || !strings.Contains(got, "createBug(") {
+		t.Errorf("DescribeType(bugs) =\n%s", got)
+	}
+}
+
+func TestDescribeOperation(t *testing.T) {
+	w := loadTestWADL(t)
+	bug := w.ResourceType("bug")
+
+	tests := []struct {
+		op   string
+		want []string
+	}{
+		{"newMessage", []string{
+			"POST newMessage on bug\n",
+			"Usage: lp-api post <bug> ws.op=newMessage content=... [subject=...]\n",
+			"  * content ",
+			"Creates: message",
+		}},
+		{"addAttachment", []string{"data=@file", "[is_patch=...]", "Creates: bug_attachment"}},
+		{"isUserAffected", []string{"Usage: lp-api get <bug> ws.op==isUserAffected [user==...]", "link → person"}},
+	}
+	for _, tt := range tests {
+		got := DescribeOperation(bug, bug.Operation(tt.op))
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("DescribeOperation(%s) is missing %q:\n%s", tt.op, want, got)
+			}
+		}
+	}
+
+	searchTasks := w.ResourceType("distribution").Operation("searchTasks")
+	got := DescribeOperation(w.ResourceType("distribution"), searchTasks)
+	if !strings.Contains(got, "Returns: collection of bug_task") || !strings.Contains(got, "Fix Released") {
+		t.Errorf("DescribeOperation(searchTasks) =\n%s", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"id": 1, "resource_type_link": "https://api.launchpad.net/devel/#bug"}`))
+	}))
+	defer server.Close()
+
+	backup := lpAPI
+	lpAPI = server.URL + "/devel/"
+	loadedWADL[lpAPI] = loadTestWADL(t)
+	t.Cleanup(func() {
+		delete(loadedWADL, lpAPI)
+		lpAPI = backup
+	})
+
+	lp := LaunchpadAPI{}
+	got, err := lp.Describe("bugs/1", lpAPI+"bugs/1", []string{"markAsDuplicate"})
+	if err != nil {
+		t.Fatalf("Describe(bugs/1) error = %v", err)
+	}
+	if !strings.HasPrefix(got, "POST markAsDuplicate on bug\n") || requests != 1 {
+		t.Errorf("Describe(bugs/1) = %q after %d requests", got, requests)
+	}
+
+	// A resource type name is described without looking up any resource
+	got, err = lp.Describe("person", lpAPI+"person", nil)
+	if err != nil {
+		t.Fatalf("Describe(person) error = %v", err)
+	}
+	if !strings.HasPrefix(got, "Resource type: person\n") || requests != 1 {
+		t.Errorf("Describe(person) = %q after %d requests", got, requests)
+	}
+
+	if _, err := lp.Describe("bug", lpAPI+"bug", []string{"noSuchOp"}); err == nil || !strings.Contains(err.Error(), "noSuchOp") {
+		t.Errorf("Describe(bug noSuchOp) error = %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/fourdollars/lp-api/lpapi"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// multipartForm keeps what a multipart request is built from, so that it can be shown without reading the files
+type multipartForm struct {
+	attachments []FileAttachment
+	params      map[string]string
+}
+
+// multipartFormKey is the context key of the multipartForm of a request
+type multipartFormKey struct{}
+
+// withMultipartForm attaches the parts of a multipart request to it
+func withMultipartForm(req *http.Request, attachments []FileAttachment, params map[string]string) *http.Request {
+	form := &multipartForm{attachments: attachments, params: params}
+	return req.WithContext(context.WithValue(req.Context(), multipartFormKey{}, form))
+}
+
+// requestMultipartForm returns the parts of a multipart request, or nil
+func requestMultipartForm(req *http.Request) *multipartForm {
+	form, _ := req.Context().Value(multipartFormKey{}).(*multipartForm)
+	return form
+}
+
+// attachmentSource names where the content of an attachment comes from
+func attachmentSource(attachment FileAttachment) string {
+	switch {
+	case attachment.Data != nil:
+		return "memory"
+	case attachment.Path == "-":
+		return "stdin"
+	}
+	return attachment.Path
+}
+
+// multipartLayout writes the multipart body of the request with placeholders instead of the file contents
+func multipartLayout(req *http.Request, form *multipartForm) (string, error) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(params["boundary"]); err != nil {
+		return "", err
+	}
+	srcs := make([]io.Reader, len(form.attachments))
+	for i, attachment := range form.attachments {
+		size := fmt.Sprintf("%d bytes", attachment.Length())
+		if attachment.Length() < 0 {
+			size = "unknown size"
+		}
+		srcs[i] = strings.NewReader(fmt.Sprintf("<%s from %s>", size, attachmentSource(attachment)))
+	}
+	if err := lpapi.WriteMultipart(writer, form.attachments, srcs, form.params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// requestBody returns the body of a request that is not sent. The files of a multipart body are not read.
+func requestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	defer req.Body.Close()
+	if form := requestMultipartForm(req); form != nil {
+		return multipartLayout(req, form)
+	}
+	body, err := io.ReadAll(req.Body)
+	return string(body), err
+}
+
+// describeRequest shows the method, the URL, the redacted headers and the body of a request
+func describeRequest(req *http.Request) (string, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, req.URL)
+	header := req.Header.Clone()
+	if req.ContentLength > 0 {
+		header.Set("Content-Length", fmt.Sprint(req.ContentLength))
+	}
+	writeHeaders(&buf, "", header, true)
+	if body != "" {
+		fmt.Fprintf(&buf, "\n%s", body)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// shellQuote quotes a word for POSIX shells
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// curlCommand returns a curl command line sending the same request, with the credential redacted
+func curlCommand(req *http.Request) (string, error) {
+	words := []string{"curl", "-X", req.Method}
+	form := requestMultipartForm(req)
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		// curl writes the Content-Type of a multipart body itself, with its own boundary
+		if form != nil && name == "Content-Type" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			words = append(words, "-H", shellQuote(name+": "+redactHeader(name, value)))
+		}
+	}
+
+	if form != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		// Values are double quoted for curl, which splits them on ';'
+		for _, attachment := range form.attachments {
+			part := fmt.Sprintf(`%s=@"%s";filename="%s"`, attachment.Field, lpapi.EscapeQuotes(attachment.Path), lpapi.EscapeQuotes(attachment.Filename))
+			if attachment.ContentType != "" {
+				part += fmt.Sprintf(`;type="%s"`, lpapi.EscapeQuotes(attachment.ContentType))
+			}
+			words = append(words, "-F", shellQuote(part))
+		}
+		keys := make([]string, 0, len(form.params))
+		for key := range form.params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			words = append(words, "--form-string", shellQuote(key+"="+form.params[key]))
+		}
+	} else {
+		body, err := requestBody(req)
+		if err != nil {
+			return "", err
+		}
+		if body != "" {
+			words = append(words, "--data-raw", shellQuote(body))
+		}
+	}
+	words = append(words, shellQuote(req.URL.String()))
+	return strings.Join(words, " "), nil
+}
+
+// skipRequest prints a write request with -dry-run or -as-curl instead of sending it.
+// Reads are still sent because the write requests may depend on them.
+func skipRequest(req *http.Request) (string, bool, error) {
+	if req.Method == "GET" || !(*dryRun || *asCurl) {
+		return "", false, nil
+	}
+	if *asCurl {
+		command, err := curlCommand(req)
+		return command, true, err
+	}
+	description, err := describeRequest(req)
+	return description, true, err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"ws.op=newMessage", `'ws.op=newMessage'`},
+		{"it's", `'it'\''s'`},
+		{"", `''`},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.word); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s %s was sent", r.Method, r.URL)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "crash.log")
+	if err := os.WriteFile(logFile, []byte("Segmentation fault"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDryRun, backupAsCurl := *dryRun, *asCurl
+	t.Cleanup(func() { *dryRun, *asCurl = backupDryRun, backupAsCurl })
+
+	lp := LaunchpadAPI{Credential: Credential{Key: "lp-api", Token: "token", Secret: "secret"}}
+	resource := server.URL + "/devel/bugs/1"
+	tests := []struct {
+		name   string
+		asCurl bool
+		send   func() (string, error)
+		want   []string
+	}{
+		{
+			name: "form",
+			send: func() (string, error) {
+				return lp.Post(resource, []string{"ws.op=newMessage", "content=it's fixed"})
+			},
+			want: []string{
+				"POST " + resource + "\n",
+				`oauth_token="REDACTED"`,
+				"Content-Type: application/x-www-form-urlencoded\n",
+				"\ncontent=it%27s+fixed&ws.op=newMessage",
+			},
+		},
+		{
+			name: "multipart",
+			send: func() (string, error) {
+				return lp.Post(resource, []string{"ws.op=addAttachment", "attachment=@" + logFile, "comment=Log"})
+			},
+			want: []string{
+				"Content-Type: multipart/form-data; boundary=",
+				"Content-Disposition: form-data; name=\"data\"; filename=\"crash.log\"\r\nContent-Type: text/x-log",
+				"<18 bytes from " + logFile + ">",
+				"Content-Disposition: form-data; name=\"comment\"\r\n\r\nLog\r\n",
+			},
+		},
+		{
+			name: "patch",
+			send: func() (string, error) {
+				return lp.PatchEntry(resource, map[string]interface{}{"title": "Crash"}, nil, `"etag"`)
+			},
+			want: []string{"PATCH " + resource + "\n", "If-Match: \"etag\"\n", "\n{\"title\":\"Crash\"}"},
+		},
+		{
+			name: "delete",
+			send: func() (string, error) { return lp.Delete(resource) },
+			want: []string{"DELETE " + resource + "\nAuthorization: "},
+		},
+		{
+			name:   "curl form",
+			asCurl: true,
+			send: func() (string, error) {
+				return lp.Post(resource, []string{"ws.op=newMessage", "content=it's fixed"})
+			},
+			want: []string{
+				"curl -X POST -H 'Authorization: OAuth ",
+				`oauth_signature="REDACTED"`,
+				"-H 'Content-Type: application/x-www-form-urlencoded' --data-raw 'content=it%27s+fixed&ws.op=newMessage' '" + resource + "'",
+			},
+		},
+		{
+			name:   "curl multipart",
+			asCurl: true,
+			send: func() (string, error) {
+				return lp.Post(resource, []string{"ws.op=addAttachment", "attachment=@" + logFile, "comment=it's a log"})
+			},
+			want: []string{
+				`-F 'data=@"` + logFile + `";filename="crash.log";type="text/x-log; charset=utf-8"'`,
+				`--form-string 'comment=it'\''s a log' --form-string 'filename=crash.log' --form-string 'ws.op=addAttachment' '` + resource + "'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*dryRun, *asCurl = !tt.asCurl, tt.asCurl
+			got, err := tt.send()
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, got)
+				}
+			}
+			if strings.Contains(got, "secret") || strings.Contains(got, `"token"`) {
+				t.Errorf("output shows the credential:\n%s", got)
+			}
+			if tt.asCurl && strings.Contains(got, "multipart/form-data") {
+				t.Errorf("curl command sets the multipart boundary:\n%s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readOnlyFields lists the fields of an entry representation that can never be changed
+var readOnlyFields = map[string]bool{
+	"http_etag":          true,
+	"resource_type_link": true,
+	"self_link":          true,
+	"web_link":           true,
+}
+
+// isEditableField checks if a field of an entry representation is worth offering for editing
+func isEditableField(key string) bool {
+	return !readOnlyFields[key] && !strings.HasSuffix(key, "_collection_link")
+}
+
+// decodeEntry decodes a JSON entry representation, keeping numbers as they are
+func decodeEntry(payload []byte) (map[string]interface{}, error) {
+	var entry map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entry); err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	return entry, nil
+}
+
+// editableFields picks the named fields of the entry, or all the editable ones when no field is named.
+// When the resource type of the entry is known, only its writable fields are editable.
+func editableFields(entry map[string]interface{}, rt *ResourceType, fields []string) (map[string]interface{}, error) {
+	selected := make(map[string]interface{})
+	if len(fields) == 0 {
+		for key, value := range entry {
+			if rt != nil && len(rt.Fields) > 0 {
+				if field := rt.Field(key); field == nil || !field.Writable {
+					continue
+				}
+			}
+			if isEditableField(key) {
+				selected[key] = value
+			}
+		}
+		return selected, nil
+	}
+	for _, field := range fields {
+		value, ok := entry[field]
+		if !ok {
+			return nil, fmt.Errorf("There is no such '%s' field.", field)
+		}
+		selected[field] = value
+	}
+	return selected, nil
+}
+
+// yamlValue converts JSON numbers so that they are written as plain YAML numbers
+func yamlValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value.String()
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[key] = yamlValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = yamlValue(item)
+		}
+		return converted
+	}
+	return v
+}
+
+// encodeFields writes the fields in the format used in the editor
+func encodeFields(fields map[string]interface{}, format string) (string, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(fields, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(yamlValue(fields)); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// stripComments removes the leading comment lines added for the editor
+func stripComments(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], "#") {
+		i++
+	}
+	return strings.Join(lines[i:], "")
+}
+
+// decodeFields parses the fields saved in the editor
+func decodeFields(text string, format string) (map[string]interface{}, error) {
+	text = stripComments(text)
+	if format == "json" {
+		return decodeEntry([]byte(text))
+	}
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal([]byte(text), &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("expected a mapping of fields")
+	}
+	return fields, nil
+}
+
+// sameValue compares two field values by their JSON encoding
+func sameValue(a interface{}, b interface{}) bool {
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && bytes.Equal(x, y)
+}
+
+// changedFields returns the fields whose values differ from the original ones
+func changedFields(original map[string]interface{}, edited map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for key, value := range edited {
+		if before, ok := original[key]; !ok || !sameValue(before, value) {
+			changes[key] = value
+		}
+	}
+	return changes
+}
+
+// editHeader explains what to do in the editor and why it was reopened
+func editHeader(resource string, problem error) string {
+	var header strings.Builder
+	if problem != nil {
+		for _, line := range strings.Split(strings.TrimSpace(problem.Error()), "\n") {
+			header.WriteString("# ERROR: " + line + "\n")
+		}
+		header.WriteString("#\n")
+	}
+	header.WriteString("# Editing " + resource + "\n")
+	header.WriteString("# Only the changed fields will be sent. Save an empty file to cancel.\n")
+	return header.String()
+}
+
+// runEditor opens text in $VISUAL or $EDITOR and returns what was saved
+func runEditor(text string, format string) (string, error) {
+	file, err := os.CreateTemp("", "lp-api-edit-*."+format)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	command := strings.Fields(editor)
+	cmd := exec.Command(command[0], append(command[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if *debug {
+		log.Print("EDITOR ", cmd.Args)
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("Editor %s failed: %v", editor, err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// fetchEntry gets the entry at resource with the fields to edit and its ETag
+func (lp *LaunchpadAPI) fetchEntry(resource string, fields []string) (map[string]interface{}, string, error) {
+	req, err := lp.GetRequest(resource, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	// The ETag must be the current one, not the one of a cached copy
+	req.Header.Set("Cache-Control", "no-cache")
+	payload, err := lp.DoProcess(req)
+	if err != nil {
+		return nil, "", err
+	}
+	entry, err := decodeEntry([]byte(payload))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is not an entry: %v", resource, err)
+	}
+	etag, _ := entry["http_etag"].(string)
+	var rt *ResourceType
+	if w, err := lp.LoadWADL(); err == nil {
+		rt = w.EntryType(entry)
+	} else if *debug {
+		log.Print(err)
+	}
+	selected, err := editableFields(entry, rt, fields)
+	return selected, etag, err
+}
+
+// Edit opens the writable fields of an entry, or only the named ones, in an editor and patches the changed fields.
+// Arguments are field names, plus -json or -yaml to choose the format used in the editor.
+func (lp *LaunchpadAPI) Edit(resource string, args []string) (string, error) {
+	if *debug {
+		log.Print("EDIT ", resource, " ", args)
+	}
+	format := "yaml"
+	var fields []string
+	for _, arg := range args {
+		switch arg {
+		case "-json", "--json":
+			format = "json"
+		case "-yaml", "--yaml":
+			format = "yaml"
+		default:
+			fields = append(fields, arg)
+		}
+	}
+	sort.Strings(fields)
+
+	original, etag, err := lp.fetchEntry(resource, fields)
+	if err != nil {
+		return "", err
+	}
+	content, err := encodeFields(original, format)
+	if err != nil {
+		return "", err
+	}
+
+	text := editHeader(resource, nil) + content
+	var problem error
+	conflict := false
+	for {
+		edited, err := runEditor(text, format)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(stripComments(edited)) == "" {
+			return "", errors.New("Edit cancelled, the file is empty.")
+		}
+		if problem != nil && !conflict && edited == text {
+			return "", fmt.Errorf("Edit cancelled: %v", problem)
+		}
+
+		problem = nil
+		conflict = false
+		content = stripComments(edited)
+		values, err := decodeFields(edited, format)
+		if err != nil {
+			problem = fmt.Errorf("Invalid %s: %v", strings.ToUpper(format), err)
+		} else {
+			// The changes are those made to the version that was loaded in the editor
+			changes := changedFields(original, values)
+			if len(changes) == 0 {
+				fmt.Fprintln(os.Stderr, "No changes made.")
+				return "", nil
+			}
+			payload, err := lp.PatchEntry(resource, changes, nil, etag)
+			if err == nil {
+				return payload, nil
+			}
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				return "", err
+			}
+			switch httpErr.StatusCode {
+			case http.StatusPreconditionFailed:
+				// Someone else changed the entry meanwhile. Only the changed fields are applied on top of
+				// the latest version, so that the other changes survive.
+				original, etag, err = lp.fetchEntry(resource, fields)
+				if err != nil {
+					return "", err
+				}
+				merged := make(map[string]interface{}, len(original))
+				for key, value := range original {
+					merged[key] = value
+				}
+				for key, value := range changes {
+					merged[key] = value
+				}
+				if content, err = encodeFields(merged, format); err != nil {
+					return "", err
+				}
+				problem = errors.New("The entry was changed by someone else. Your changes are kept on top of the latest version, save again to apply them.")
+				conflict = true
+			case http.StatusBadRequest:
+				problem = httpErr
+			default:
+				return "", err
+			}
+		}
+		text = editHeader(resource, problem) + content
+	}
+}
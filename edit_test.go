@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeFields(t *testing.T) {
+	entry, err := decodeEntry([]byte(`{"id": 1923283, "title": "Old title", "description": "Line one\nLine two", "tags": ["focal"], "private": false, "http_etag": "\"abc\"", "self_link": "https://api.launchpad.net/devel/bugs/1923283", "messages_collection_link": "https://api.launchpad.net/devel/bugs/1923283/messages", "date_created": "2021-04-09T11:22:33.123456+00:00"}`))
+	if err != nil {
+		t.Fatalf("decodeEntry() error = %v", err)
+	}
+	fields, err := editableFields(entry, nil, nil)
+	if err != nil {
+		t.Fatalf("editableFields() error = %v", err)
+	}
+	for _, hidden := range []string{"http_etag", "self_link", "messages_collection_link"} {
+		if _, ok := fields[hidden]; ok {
+			t.Errorf("editableFields() kept %q", hidden)
+		}
+	}
+
+	for _, format := range []string{"yaml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			text, err := encodeFields(fields, format)
+			if err != nil {
+				t.Fatalf("encodeFields() error = %v", err)
+			}
+			decoded, err := decodeFields(editHeader("bugs/1923283", nil)+text, format)
+			if err != nil {
+				t.Fatalf("decodeFields() error = %v\n%s", err, text)
+			}
+			if changes := changedFields(fields, decoded); len(changes) != 0 {
+				t.Errorf("round trip changed %v\n%s", changes, text)
+			}
+		})
+	}
+
+	if _, err := editableFields(entry, nil, []string{"nonexistent"}); err == nil {
+		t.Error("editableFields() expected error for a missing field")
+	}
+
+	// With the WADL only the writable fields are offered
+	entry["resource_type_link"] = "https://api.launchpad.net/devel/#bug"
+	w := loadTestWADL(t)
+	fields, err = editableFields(entry, w.EntryType(entry), nil)
+	if err != nil {
+		t.Fatalf("editableFields() error = %v", err)
+	}
+	if len(fields) != 3 || fields["title"] == nil || fields["description"] == nil || fields["tags"] == nil {
+		t.Errorf("editableFields() = %v, want description, tags and title", fields)
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	original := map[string]interface{}{
+		"title": "Old title",
+		"tags":  []interface{}{"focal"},
+		"id":    json.Number("1"),
+	}
+	edited := map[string]interface{}{
+		"title": "New title",
+		"tags":  []interface{}{"focal"},
+		"id":    1,
+	}
+	changes := changedFields(original, edited)
+	if len(changes) != 1 || changes["title"] != "New title" {
+		t.Errorf("changedFields() = %v, want only the title", changes)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tmpDir := t.TempDir()
+	editor := filepath.Join(tmpDir, "editor.sh")
+	script := "#!/bin/sh\nsed -i 's/^title: Old title$/title: New title/' \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create editor script: %v", err)
+	}
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	etag := `"first"`
+	var patches []map[string]interface{}
+	var ifMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"title":       "Old title",
+				"description": "Unchanged",
+				"http_etag":   etag,
+			})
+		case "PATCH":
+			var data map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&data)
+			patches = append(patches, data)
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.Write([]byte(`{"title": "New title"}`))
+		}
+	}))
+	defer server.Close()
+
+	lp := LaunchpadAPI{}
+	payload, err := lp.Edit(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if !strings.Contains(payload, "New title") {
+		t.Errorf("Edit() = %q", payload)
+	}
+	if len(patches) != 1 || len(patches[0]) != 1 || patches[0]["title"] != "New title" {
+		t.Errorf("Edit() sent %v, want only the new title", patches)
+	}
+	if ifMatch[0] != `"first"` {
+		t.Errorf("If-Match = %q, want %q", ifMatch[0], `"first"`)
+	}
+
+	// The entry changes between GET and PATCH, so the editor is reopened and the edits are sent again
+	patches, ifMatch = nil, nil
+	etag = `"second"`
+	first := true
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]interface{}{"title": "Old title", "http_etag": etag})
+			if first {
+				etag = `"third"`
+				first = false
+			}
+		case "PATCH":
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.Write([]byte(`{"title": "New title"}`))
+		}
+	})
+	if _, err := lp.Edit(server.URL, []string{"title"}); err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if strings.Join(ifMatch, " ") != `"second" "third"` {
+		t.Errorf("If-Match headers = %v, want the stale and then the fresh ETag", ifMatch)
+	}
+
+	// A field changed by someone else meanwhile keeps its new value, only the edited field is sent again
+	patches, ifMatch = nil, nil
+	etag = `"fifth"`
+	description := "Unchanged"
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]interface{}{"title": "Old title", "description": description, "http_etag": etag})
+			if description == "Unchanged" {
+				etag, description = `"sixth"`, "Changed by someone else"
+			}
+		case "PATCH":
+			var data map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&data)
+			patches = append(patches, data)
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.Write([]byte(`{"title": "New title"}`))
+		}
+	})
+	if _, err := lp.Edit(server.URL, []string{"description", "title"}); err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if len(patches) != 2 || len(patches[1]) != 1 || patches[1]["title"] != "New title" {
+		t.Errorf("Edit() sent %v, want only the new title after the conflict", patches)
+	}
+
+	// A copy of the entry fresh enough for -max-age is not used for its ETag
+	backupCache, backupMaxAge := *useCache, *maxAge
+	*useCache, *maxAge = true, time.Hour
+	t.Cleanup(func() { *useCache, *maxAge = backupCache, backupMaxAge })
+	if _, err := lp.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	patches, ifMatch = nil, nil
+	etag = `"fourth"`
+	if _, err := lp.Edit(server.URL, []string{"title"}); err != nil {
+		t.Fatalf("Edit() with -cache error = %v", err)
+	}
+	if strings.Join(ifMatch, " ") != `"fourth"` {
+		t.Errorf("If-Match headers with -cache = %v, want the current ETag", ifMatch)
+	}
+}
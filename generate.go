@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// initialisms lists the words of WADL names that Go spells in capitals
+var initialisms = map[string]bool{
+	"api":  true,
+	"http": true,
+	"id":   true,
+	"ip":   true,
+	"json": true,
+	"uri":  true,
+	"url":  true,
+}
+
+// goName turns a WADL name such as bug_task, date_created or newMessage into an exported Go name
+func goName(name string) string {
+	var out strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if initialisms[word] {
+			out.WriteString(strings.ToUpper(word))
+		} else {
+			out.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return out.String()
+}
+
+// goType maps a WADL type to the Go type of fields and parameters
+func goType(typ string) string {
+	switch typ {
+	case "int":
+		return "int"
+	case "float":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "dateTime":
+		return "time.Time"
+	}
+	return "string"
+}
+
+// isSet is the condition telling that an optional parameter holds a value to send
+func isSet(typ string, field string) string {
+	switch typ {
+	case "int", "float64":
+		return field + " != 0"
+	case "bool":
+		return field
+	case "time.Time":
+		return "!" + field + ".IsZero()"
+	}
+	return field + ` != ""`
+}
+
+// writeDoc writes documentation text as a Go comment
+func writeDoc(out *strings.Builder, indent string, doc string) {
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(out, "%s// %s\n", indent, line)
+	}
+}
+
+// isEntryType tells if a resource type describes entries that get a generated struct
+func isEntryType(rt *ResourceType) bool {
+	return len(rt.Fields) > 0 && !rt.IsCollection() && rt.Name != "service-root" && !strings.HasSuffix(rt.Name, "-page-resource")
+}
+
+// clientGenerator writes the typed client for the resource types of a WADL
+type clientGenerator struct {
+	w   *WADL
+	out strings.Builder
+}
+
+// generated tells if a struct is generated for the named resource type
+func (g *clientGenerator) generated(name string) bool {
+	rt := g.w.ResourceType(name)
+	return rt != nil && isEntryType(rt)
+}
+
+// methodName picks the Go name of the method of a named operation among the names taken by the fields and
+// the other methods of its type. A name already taken gets the Op suffix, so that the code still compiles.
+func methodName(taken map[string]bool, receiver string, op *Operation) (string, error) {
+	for _, method := range []string{goName(op.Name), goName(op.Name) + "Op"} {
+		if !taken[method] {
+			taken[method] = true
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("The %s named operation of %s clashes with the other names of %s.", op.Name, receiver, receiver)
+}
+
+// writeEntry writes the struct of an entry type, its accessors for links and its named operations
+func (g *clientGenerator) writeEntry(rt *ResourceType) error {
+	name := goName(rt.Name)
+	fmt.Fprintf(&g.out, "// %s is an entry of the %s resource type.\n", name, rt.Name)
+	if rt.Doc != "" {
+		g.out.WriteString("//\n")
+		writeDoc(&g.out, "", rt.Doc)
+	}
+	fmt.Fprintf(&g.out, "type %s struct {\n\tentryBase\n\n", name)
+	for _, field := range rt.Fields {
+		if field.Doc != "" {
+			writeDoc(&g.out, "\t", firstLine(field.Doc))
+		}
+		fmt.Fprintf(&g.out, "\t%s %s `json:\"%s\"`\n", goName(field.Name), goType(field.Type), field.Name)
+	}
+	g.out.WriteString("}\n\n")
+
+	fmt.Fprintf(&g.out, "// %s fetches the %s at link.\n", name, rt.Name)
+	fmt.Fprintf(&g.out, "func (c *Client) %s(link string) (*%s, error) {\n\treturn getEntry[%s](c, link, nil)\n}\n\n", name, name, name)
+
+	// Field is promoted from entryBase
+	taken := map[string]bool{"Field": true}
+	for _, field := range rt.Fields {
+		taken[goName(field.Name)] = true
+	}
+	methods := make([]string, len(rt.Operations))
+	for i, op := range rt.Operations {
+		method, err := methodName(taken, name, op)
+		if err != nil {
+			return err
+		}
+		methods[i] = method
+	}
+	for _, field := range rt.Fields {
+		var method, target string
+		collection := false
+		switch {
+		case strings.HasSuffix(field.Name, "_collection_link"):
+			method = goName(strings.TrimSuffix(field.Name, "_collection_link"))
+			target, collection = strings.TrimSuffix(field.LinkType, "-page-resource"), true
+		case strings.HasSuffix(field.Name, "_link") && field.LinkType != "":
+			method = goName(strings.TrimSuffix(field.Name, "_link"))
+			target = field.LinkType
+		default:
+			continue
+		}
+		if taken[method] || !g.generated(target) {
+			continue
+		}
+		taken[method] = true
+		if collection {
+			fmt.Fprintf(&g.out, "// %s fetches the first page of %s.\n", method, field.Name)
+			fmt.Fprintf(&g.out, "func (x *%s) %s() (*Page[%s], error) {\n\treturn getPage[%s](x.client, x.%s, nil)\n}\n\n", name, method, goName(target), goName(target), goName(field.Name))
+		} else {
+			fmt.Fprintf(&g.out, "// %s fetches the entry at %s.\n", method, field.Name)
+			fmt.Fprintf(&g.out, "func (x *%s) %s() (*%s, error) {\n\treturn getEntry[%s](x.client, x.%s, nil)\n}\n\n", name, method, goName(target), goName(target), goName(field.Name))
+		}
+	}
+
+	for i, op := range rt.Operations {
+		g.writeOperation(name, methods[i], "x.SelfLink", op)
+	}
+	return nil
+}
+
+// writeCollection writes the type of a top-level collection and its named operations
+func (g *clientGenerator) writeCollection(rt *ResourceType, path string) error {
+	name := goName(rt.Name)
+	fmt.Fprintf(&g.out, "// %s is the top-level %s collection.\n", name, path)
+	if rt.Doc != "" {
+		g.out.WriteString("//\n")
+		writeDoc(&g.out, "", rt.Doc)
+	}
+	fmt.Fprintf(&g.out, "type %s struct {\n\tclient *Client\n}\n\n", name)
+	fmt.Fprintf(&g.out, "// %s returns the top-level %s collection.\n", name, path)
+	fmt.Fprintf(&g.out, "func (c *Client) %s() *%s {\n\treturn &%s{client: c}\n}\n\n", name, name, name)
+	taken := make(map[string]bool)
+	for _, op := range rt.Operations {
+		method, err := methodName(taken, name, op)
+		if err != nil {
+			return err
+		}
+		g.writeOperation(name, method, fmt.Sprintf("%q", path), op)
+	}
+	return nil
+}
+
+// writeOperation writes the method sending a named operation and the struct of its parameters
+func (g *clientGenerator) writeOperation(receiver string, method string, link string, op *Operation) {
+	params := receiver + method + "Params"
+	if len(op.Params) > 0 {
+		fmt.Fprintf(&g.out, "// %s holds the parameters of %s.%s. Optional parameters are left out when they hold their zero value.\n", params, receiver, method)
+		fmt.Fprintf(&g.out, "type %s struct {\n", params)
+		for _, param := range op.Params {
+			var doc []string
+			if param.Doc != "" {
+				doc = append(doc, firstLine(param.Doc))
+			}
+			if param.Required {
+				doc = append(doc, "Required.")
+			}
+			if param.Type == "binary" {
+				doc = append(doc, "The path of the file to upload.")
+			}
+			if len(param.Options) > 0 {
+				doc = append(doc, "One of: "+strings.Join(param.Options, ", ")+".")
+			}
+			if len(doc) > 0 {
+				writeDoc(&g.out, "\t", strings.Join(doc, "\n"))
+			}
+			fmt.Fprintf(&g.out, "\t%s %s\n", goName(param.Name), goType(param.Type))
+		}
+		g.out.WriteString("}\n\n")
+	}
+
+	var result, call string
+	switch {
+	case op.Returns != "" && op.ReturnsCollection && g.generated(op.Returns) && op.Method == "GET":
+		result = "*Page[" + goName(op.Returns) + "]"
+		call = fmt.Sprintf("getPage[%s](x.client, %s, args)", goName(op.Returns), link)
+	case op.Returns != "" && g.generated(op.Returns) && op.Method == "GET":
+		result = "*" + goName(op.Returns)
+		call = fmt.Sprintf("getEntry[%s](x.client, %s, args)", goName(op.Returns), link)
+	case op.Returns != "" && !op.ReturnsCollection && g.generated(op.Returns):
+		result = "*" + goName(op.Returns)
+		call = fmt.Sprintf("postEntry[%s](x.client, %s, args)", goName(op.Returns), link)
+	default:
+		result = "string"
+		call = fmt.Sprintf("x.client.%s(%s, args)", strings.ToLower(op.Method), link)
+	}
+
+	fmt.Fprintf(&g.out, "// %s sends the %s named operation with %s.\n", method, op.Name, op.Method)
+	if op.Doc != "" {
+		g.out.WriteString("//\n")
+		writeDoc(&g.out, "", op.Doc)
+	}
+	switch {
+	case result == "string" && op.Creates != "":
+		fmt.Fprintf(&g.out, "//\n// It returns the link of the new %s.\n", op.Creates)
+	case result == "string":
+		g.out.WriteString("//\n// It returns the body of the response.\n")
+	}
+	signature := ""
+	if len(op.Params) > 0 {
+		signature = "p " + params
+	}
+	fmt.Fprintf(&g.out, "func (x *%s) %s(%s) (%s, error) {\n", receiver, method, signature, result)
+	separator := "="
+	arg := "formArg"
+	if op.Method == "GET" {
+		separator, arg = "==", "queryArg"
+	}
+	fmt.Fprintf(&g.out, "\targs := []string{\"ws.op%s%s\"}\n", separator, op.Name)
+	for _, param := range op.Params {
+		field := "p." + goName(param.Name)
+		encode := fmt.Sprintf("%s(%q, %s)", arg, param.Name, field)
+		if param.Type == "binary" {
+			encode = fmt.Sprintf("fileArg(%q, %s)", param.Name, field)
+		}
+		if param.Required {
+			fmt.Fprintf(&g.out, "\targs = append(args, %s)\n", encode)
+		} else {
+			fmt.Fprintf(&g.out, "\tif %s {\n\t\targs = append(args, %s)\n\t}\n", isSet(goType(param.Type), field), encode)
+		}
+	}
+	fmt.Fprintf(&g.out, "\treturn %s\n}\n\n", call)
+}
+
+// GenerateClient generates the Go source of the typed client for the entry types and top-level collections of a WADL
+func GenerateClient(w *WADL, pkg string) ([]byte, error) {
+	g := &clientGenerator{w: w}
+
+	paths := make(map[string]string)
+	for path, name := range w.Collections {
+		paths[name] = path
+	}
+	for _, name := range w.ResourceTypeNames() {
+		rt := w.ResourceType(name)
+		var err error
+		if path, ok := paths[name]; ok && rt.IsCollection() {
+			err = g.writeCollection(rt, path)
+		} else if isEntryType(rt) {
+			err = g.writeEntry(rt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body := g.out.String()
+	header := fmt.Sprintf("// Code generated by lp-api __generate-client from the WADL of %s. DO NOT EDIT.\n\npackage %s\n\n", w.Base, pkg)
+	if strings.Contains(body, "time.Time") {
+		header += "import \"time\"\n\n"
+	}
+	source, err := format.Source([]byte(header + body))
+	if err != nil {
+		return nil, fmt.Errorf("Generated code is not valid Go: %v", err)
+	}
+	return source, nil
+}
+
+// generateClientCommand implements `lp-api __generate-client -wadl file -o file`, run by go generate in lpclient
+func generateClientCommand(args []string) error {
+	flags := flag.NewFlagSet("__generate-client", flag.ContinueOnError)
+	wadlPath := flags.String("wadl", "", "The WADL file to generate the client from.")
+	fetchRoot := flags.String("fetch", "", "The service root whose WADL is first downloaded to the -wadl file, such as https://api.launchpad.net/devel/.")
+	outputPath := flags.String("o", "", "The Go file to write, or stdout.")
+	pkg := flags.String("package", "lpclient", "The name of the generated package.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *wadlPath == "" {
+		return errors.New("Usage: lp-api __generate-client [-fetch service-root] -wadl file.xml [-o file.go] [-package name]")
+	}
+	if *fetchRoot != "" {
+		if err := snapshotWADL(*fetchRoot, *wadlPath); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(*wadlPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w, err := ParseWADL(file)
+	if err != nil {
+		return err
+	}
+	source, err := GenerateClient(w, *pkg)
+	if err != nil {
+		return err
+	}
+	if *outputPath == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(*outputPath, source, 0644)
+}
+
+// snapshotWADL downloads the WADL of the service root to path, which keeps its previous content unless the new one is valid
+func snapshotWADL(root string, path string) error {
+	req, err := http.NewRequest("GET", root, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.sun.wadl+xml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to get the WADL of %s: %s", root, resp.Status)
+	}
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := ParseWADL(io.TeeReader(resp.Body, file)); err != nil {
+		file.Abort()
+		return fmt.Errorf("Invalid WADL from %s: %v", root, err)
+	}
+	// The parser may stop before the end of the document
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
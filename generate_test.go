@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fourdollars/lp-api/lpapi"
+	"github.com/fourdollars/lp-api/lpclient"
+)
+
+// LaunchpadAPI and lpapi.Client are transports of the generated client
+var _ lpclient.Transport = (*LaunchpadAPI)(nil)
+var _ lpclient.Transport = (*lpapi.Client)(nil)
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"bug_task", "BugTask"},
+		{"date_created", "DateCreated"},
+		{"id", "ID"},
+		{"build_log_url", "BuildLogURL"},
+		{"http_etag", "HTTPEtag"},
+		{"newMessage", "NewMessage"},
+		{"source_package_publishing_history", "SourcePackagePublishingHistory"},
+	}
+	for _, tt := range tests {
+		if got := goName(tt.name); got != tt.want {
+			t.Errorf("goName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestGenerateClient checks the generated source for the fixture WADL against its golden copy
+func TestGenerateClient(t *testing.T) {
+	got, err := GenerateClient(loadTestWADL(t), "lpclient")
+	if err != nil {
+		t.Fatalf("GenerateClient() error = %v", err)
+	}
+	want, err := os.ReadFile("testdata/lpclient.golden")
+	if err != nil {
+		t.Fatalf("Failed to read the golden client: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("the client generated from testdata/wadl-devel.xml differs from testdata/lpclient.golden")
+	}
+}
+
+// buildClient checks that the lpclient package compiles with source in place of zz_generated.go
+func buildClient(t *testing.T, source []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "zz_generated.go")
+	if err := os.WriteFile(generated, source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkedIn, err := filepath.Abs("lpclient/zz_generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := json.Marshal(map[string]interface{}{"Replace": map[string]string{checkedIn: generated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlayPath := filepath.Join(dir, "overlay.json")
+	if err := os.WriteFile(overlayPath, overlay, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-overlay", overlayPath, "./lpclient")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("the generated client doesn't compile: %v\n%s", err, output)
+	}
+}
+
+// TestGenerateClient_snapshot checks that the checked-in client is the one generated from the WADL snapshot
+// of the devel service root, and that the client generated from the full WADL compiles
+func TestGenerateClient_snapshot(t *testing.T) {
+	file, err := os.Open("lpclient/launchpad-devel.wadl")
+	if os.IsNotExist(err) {
+		t.Fatal("lpclient/launchpad-devel.wadl is missing, run `go generate ./lpclient` to download it")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w, err := ParseWADL(file)
+	if err != nil {
+		t.Fatalf("ParseWADL() error = %v", err)
+	}
+	got, err := GenerateClient(w, "lpclient")
+	if err != nil {
+		t.Fatalf("GenerateClient() error = %v", err)
+	}
+	buildClient(t, got)
+	want, err := os.ReadFile("lpclient/zz_generated.go")
+	if err != nil {
+		t.Fatalf("Failed to read the generated client: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("lpclient/zz_generated.go is out of date, run `go generate ./lpclient`")
+	}
+}
+
+// TestGenerateClient_clashes checks that named operations named like a field, a link accessor or another
+// operation get methods of their own
+func TestGenerateClient_clashes(t *testing.T) {
+	w := &WADL{
+		Base:        "https://api.launchpad.net/devel/",
+		Collections: map[string]string{},
+		ResourceTypes: map[string]*ResourceType{
+			"person": {Name: "person", Fields: []*Field{{Name: "self_link", Type: "link"}, {Name: "name", Type: "string"}}},
+			"bug": {
+				Name: "bug",
+				Fields: []*Field{
+					{Name: "self_link", Type: "link"},
+					{Name: "tags", Type: "string"},
+					{Name: "owner_link", Type: "link", LinkType: "person"},
+				},
+				Operations: []*Operation{
+					{Name: "tags", Method: "GET"},
+					{Name: "field", Method: "GET"},
+					{Name: "owner", Method: "POST"},
+					{Name: "Owner", Method: "POST"},
+				},
+			},
+		},
+	}
+	source, err := GenerateClient(w, "lpclient")
+	if err != nil {
+		t.Fatalf("GenerateClient() error = %v", err)
+	}
+	for _, method := range []string{"TagsOp", "FieldOp", "Owner", "OwnerOp"} {
+		if !strings.Contains(string(source), "func (x *Bug) "+method+"(") {
+			t.Errorf("there is no Bug.%s method in the generated client", method)
+		}
+	}
+	buildClient(t, source)
+
+	w.ResourceTypes["bug"].Operations = append(w.ResourceTypes["bug"].Operations, &Operation{Name: "owner", Method: "GET"})
+	if _, err := GenerateClient(w, "lpclient"); err == nil {
+		t.Error("GenerateClient() of a third owner operation succeeded")
+	}
+}
+
+func TestSnapshotWADL(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/wadl-devel.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.sun.wadl+xml" {
+			w.Write([]byte(`{"resource_type_link": "#service-root"}`))
+			return
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "launchpad-devel.wadl")
+	output := filepath.Join(dir, "zz_generated.go")
+	if err := generateClientCommand([]string{"-fetch", server.URL + "/devel/", "-wadl", snapshot, "-o", output}); err != nil {
+		t.Fatalf("generateClientCommand(-fetch) error = %v", err)
+	}
+	if data, err := os.ReadFile(snapshot); err != nil || !bytes.Equal(data, fixture) {
+		t.Errorf("the snapshot differs from the WADL served, %v", err)
+	}
+	golden, _ := os.ReadFile("testdata/lpclient.golden")
+	if data, err := os.ReadFile(output); err != nil || !bytes.Equal(data, golden) {
+		t.Errorf("the client generated from the snapshot differs from testdata/lpclient.golden, %v", err)
+	}
+
+	// A failed download keeps the previous snapshot
+	server.Close()
+	if err := generateClientCommand([]string{"-fetch", server.URL + "/devel/", "-wadl", snapshot, "-o", output}); err == nil {
+		t.Error("generateClientCommand(-fetch) of a closed server succeeded")
+	}
+	if data, err := os.ReadFile(snapshot); err != nil || !bytes.Equal(data, fixture) {
+		t.Errorf("the snapshot changed after a failed download, %v", err)
+	}
+}
@@ -4,4 +4,5 @@ go 1.20
 
 require (
 	github.com/pelletier/go-toml/v2 v2.0.7
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cacheEntry is the metadata line at the beginning of a cached response, followed by its body.
+// The modification time of the file is when Launchpad last confirmed the response.
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	Accept     string      `json:"accept,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+}
+
+// httpCacheDir returns the directory of the cached responses
+func httpCacheDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "http"), nil
+}
+
+// tokenField matches the token of the OAuth Authorization header
+var tokenField = regexp.MustCompile(`oauth_token="([^"]*)"`)
+
+// cacheKey returns the name of the cached response of a URL for the user of the request, so
+// that users sharing a cache directory never see the private data of each other
+func cacheKey(req *http.Request) string {
+	token := ""
+	if m := tokenField.FindStringSubmatch(req.Header.Get("Authorization")); m != nil {
+		token = m[1]
+	}
+	sum := sha256.Sum256([]byte(token + "\n" + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheTransport answers GET requests from the cache directory and stores the responses of next
+type cacheTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// withCache returns the transport of -cache around next, or next itself when the cache isn't used
+func withCache(next http.RoundTripper) (http.RoundTripper, error) {
+	if !*useCache {
+		return next, nil
+	}
+	dir, err := httpCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &cacheTransport{dir: dir, next: next}, nil
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(t.dir, cacheKey(req))
+	if req.Method != "GET" {
+		resp, err := t.next.RoundTrip(req)
+		// The entry has changed, or a failed If-Match tells it changed since it was read
+		if err == nil && (resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusPreconditionFailed) {
+			os.Remove(path)
+		}
+		return resp, err
+	}
+	if req.Header.Get("Range") != "" || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	entry, stored, err := readCacheEntry(path)
+	// Cache-Control: no-cache asks for a fresh response, such as the one giving the ETag of an entry to change
+	if err != nil || entry.Accept != req.Header.Get("Accept") || strings.Contains(req.Header.Get("Cache-Control"), "no-cache") {
+		entry = nil
+	}
+	if entry != nil && time.Since(stored) < *maxAge {
+		if *debug {
+			log.Print("Cache hit ", req.URL)
+		}
+		return entry.response(req, path)
+	}
+
+	conditional := req
+	if entry != nil {
+		conditional = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	resp, err := t.next.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		if *debug {
+			log.Print("Cache revalidated ", req.URL)
+		}
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return entry.response(req, path)
+	}
+	if !cacheable(resp) {
+		return resp, nil
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return nil, err
+	}
+	entry = &cacheEntry{URL: req.URL.String(), Accept: req.Header.Get("Accept"), StatusCode: resp.StatusCode, Header: resp.Header}
+	resp.Body, err = newCacheWriter(resp.Body, path, entry)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Failed to write the cache: %v", err)
+	}
+	return resp, nil
+}
+
+// cacheable tells whether a response can be stored, which needs a validator unless -max-age allows using it as is
+func cacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return false
+	}
+	return *maxAge > 0 || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// readCacheEntry returns the metadata of a cached response and when it was stored or last revalidated
+func readCacheEntry(path string) (*cacheEntry, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return nil, time.Time{}, err
+	}
+	return &entry, fi.ModTime(), nil
+}
+
+// response builds the response of a cached entry, whose body is read from the file at path
+func (e *cacheEntry) response(req *http.Request, path string) (*http.Response, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode: e.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     e.Header.Clone(),
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{reader, file},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// cacheWriter copies a response body to a temporary file while it is read, and moves it to the
+// cache once it is read completely, so that partial and concurrent downloads never corrupt an entry
+type cacheWriter struct {
+	body io.ReadCloser
+	file *os.File
+	path string
+	err  error
+}
+
+func newCacheWriter(body io.ReadCloser, path string, entry *cacheEntry) (*cacheWriter, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".response-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &cacheWriter{body: body, file: file, path: path}, nil
+}
+
+func (w *cacheWriter) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 && w.file != nil && w.err == nil {
+		_, w.err = w.file.Write(p[:n])
+	}
+	if err == io.EOF && w.file != nil {
+		w.commit()
+	}
+	return n, err
+}
+
+// commit moves the complete response to the cache, unless writing it failed
+func (w *cacheWriter) commit() {
+	name := w.file.Name()
+	if err := w.file.Close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.file = nil
+	if w.err == nil {
+		w.err = os.Rename(name, w.path)
+	}
+	if w.err != nil {
+		os.Remove(name)
+		log.Print("Failed to write the cache: ", w.err)
+	}
+}
+
+func (w *cacheWriter) Close() error {
+	if w.file != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
+		w.file = nil
+	}
+	return w.body.Close()
+}
+
+// cacheCommand runs `lp-api cache clear` and `lp-api cache stats`
+func cacheCommand(args []string) error {
+	dir, err := httpCacheDir()
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || (args[0] != "clear" && args[0] != "stats") {
+		return errors.New("Usage: lp-api cache {clear,stats}")
+	}
+	var count, size int64
+	var oldest, newest time.Time
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		size += fi.Size()
+		if oldest.IsZero() || fi.ModTime().Before(oldest) {
+			oldest = fi.ModTime()
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if args[0] == "clear" {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d responses (%d bytes) from %s\n", count, size, dir)
+		return nil
+	}
+	fmt.Printf("Directory: %s\nResponses: %d\nSize: %d bytes\n", dir, count, size)
+	if count > 0 {
+		fmt.Printf("Oldest: %s\nNewest: %s\n", oldest.Format(time.RFC3339), newest.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheTransport(t *testing.T) {
+	var requests, notModified int32
+	body := "version 1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		etag := `"` + body + `"`
+		if r.Method == "PATCH" {
+			if match := r.Header.Get("If-Match"); match != "" && match != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			body = "version 2"
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	backupCache, backupMaxAge := *useCache, *maxAge
+	*useCache = true
+	t.Cleanup(func() { *useCache, *maxAge = backupCache, backupMaxAge })
+	transport, err := withCache(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	get := func(token string, header ...string) string {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+"/bugs/1", nil)
+		req.Header.Set("Authorization", `OAuth oauth_token="`+token+`", oauth_signature="&secret"`)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("reading the body error = %v", err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name            string
+		token           string
+		maxAge          time.Duration
+		want            string
+		wantRequests    int32
+		wantNotModified int32
+	}{
+		{"stores the response", "alice", 0, "version 1", 1, 0},
+		{"revalidates with the ETag", "alice", 0, "version 1", 2, 1},
+		{"uses fresh responses as is", "alice", time.Hour, "version 1", 2, 1},
+		{"keeps the users apart", "bob", time.Hour, "version 1", 3, 1},
+	}
+	for _, tt := range tests {
+		*maxAge = tt.maxAge
+		if got := get(tt.token); got != tt.want {
+			t.Errorf("%s: body = %q, want %q", tt.name, got, tt.want)
+		}
+		if n, m := atomic.LoadInt32(&requests), atomic.LoadInt32(&notModified); n != tt.wantRequests || m != tt.wantNotModified {
+			t.Errorf("%s: %d requests and %d 304, want %d and %d", tt.name, n, m, tt.wantRequests, tt.wantNotModified)
+		}
+	}
+
+	// Changing the entry drops it from the cache even with -max-age
+	req, _ := http.NewRequest("PATCH", server.URL+"/bugs/1", strings.NewReader("{}"))
+	req.Header.Set("Authorization", `OAuth oauth_token="alice", oauth_signature="&secret"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := get("alice"); got != "version 2" {
+		t.Errorf("body after PATCH = %q, want version 2", got)
+	}
+
+	// Someone else changes the entry: no-cache gets it anyway, and a failed If-Match drops the cached copy
+	body = "version 3"
+	if got := get("alice"); got != "version 2" {
+		t.Errorf("body within -max-age = %q, want the cached version 2", got)
+	}
+	if got := get("bob", "Cache-Control", "no-cache"); got != "version 3" {
+		t.Errorf("body with Cache-Control: no-cache = %q, want version 3", got)
+	}
+	req, _ = http.NewRequest("PATCH", server.URL+"/bugs/1", strings.NewReader("{}"))
+	req.Header.Set("Authorization", `OAuth oauth_token="alice", oauth_signature="&secret"`)
+	req.Header.Set("If-Match", `"version 2"`)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a stale ETag = %d, want 412", resp.StatusCode)
+	}
+	if got := get("alice"); got != "version 3" {
+		t.Errorf("body after a failed If-Match = %q, want version 3", got)
+	}
+
+	if err := cacheCommand([]string{"stats"}); err != nil {
+		t.Errorf("cacheCommand(stats) error = %v", err)
+	}
+	if err := cacheCommand([]string{"clear"}); err != nil {
+		t.Errorf("cacheCommand(clear) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "lp-api", "http")); !os.IsNotExist(err) {
+		t.Errorf("the cache still exists after clear: %v", err)
+	}
+	if err := cacheCommand([]string{"purge"}); err == nil {
+		t.Error("cacheCommand(purge) succeeded")
+	}
+}
+
+func TestCacheWriter_partialBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"big"`)
+		w.Write([]byte(strings.Repeat("x", 1<<16)))
+	}))
+	defer server.Close()
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	backup := *useCache
+	*useCache = true
+	t.Cleanup(func() { *useCache = backup })
+	transport, err := withCache(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Read(make([]byte, 10))
+	resp.Body.Close()
+
+	dir, _ := httpCacheDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("an aborted download left %d files in the cache", len(entries))
+	}
+}
+
+func TestNewDownloadClient(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	backup := *useCache
+	*useCache = true
+	t.Cleanup(func() { *useCache = backup })
+	client, err := newDownloadClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.Transport.(*cacheTransport); ok {
+		t.Error("downloads go through the cache")
+	}
+	if client, err := newHTTPClient(0); err != nil {
+		t.Fatal(err)
+	} else if _, ok := client.Transport.(*cacheTransport); !ok {
+		t.Error("API requests don't go through the cache")
+	}
+}
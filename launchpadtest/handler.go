@@ -0,0 +1,908 @@
+package launchpadtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statuses and importances list the values a bug task accepts
+var statuses = []string{"New", "Incomplete", "Opinion", "Invalid", "Won't Fix", "Expired", "Confirmed", "Triaged", "In Progress", "Fix Committed", "Fix Released"}
+var importances = []string{"Unknown", "Undecided", "Critical", "High", "Medium", "Low", "Wishlist"}
+
+// closedStatuses are left out by searchTasks unless the status parameter asks for them, like Launchpad does
+var closedStatuses = []string{"Opinion", "Invalid", "Won't Fix", "Expired", "Fix Released"}
+
+// defaultPageSize is the number of entries of a page when ws.size is not given
+const defaultPageSize = 75
+
+// dateFormat is how Launchpad formats dates, such as 2004-08-20T00:00:00+00:00
+const dateFormat = "2006-01-02T15:04:05.999999-07:00"
+
+// oauthToken finds the token of an OAuth Authorization header
+var oauthToken = regexp.MustCompile(`oauth_token="([^"]*)"`)
+
+// apiError is answered as a plain text error with its status code, like Launchpad does
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func badRequest(format string, a ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, a...)}
+}
+
+var errNotFound = &apiError{http.StatusNotFound, "Not found"}
+var errUnauthorized = &apiError{http.StatusUnauthorized, "Unauthorized"}
+var errMethod = &apiError{http.StatusMethodNotAllowed, "Method not allowed"}
+
+// request is the context of a request to the API
+type request struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	root string
+	user string
+}
+
+// link returns the API link of a resource
+func (q *request) link(resource string) string {
+	return q.root + resource
+}
+
+// name returns the resource of an API link of the server, such as ~alice for its link
+func (q *request) name(link string) string {
+	return strings.TrimPrefix(link, q.root)
+}
+
+func (q *request) writeJSON(status int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q.w.Header().Set("Content-Type", "application/json")
+	q.w.WriteHeader(status)
+	_, err = q.w.Write(data)
+	return err
+}
+
+// writeEntry answers with the representation of an entry and its ETag
+func (q *request) writeEntry(status int, entry map[string]interface{}) error {
+	if etag, ok := entry["http_etag"].(string); ok {
+		q.w.Header().Set("ETag", etag)
+	}
+	return q.writeJSON(status, entry)
+}
+
+// created answers 201 Created with the link of the new entry
+func (q *request) created(resource string) error {
+	q.w.Header().Set("Location", q.link(resource))
+	q.w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// writeCollection answers with the page of entries asked by ws.start and ws.size
+func (q *request) writeCollection(typ string, entries []map[string]interface{}) error {
+	query := q.r.URL.Query()
+	start, _ := strconv.Atoi(query.Get("ws.start"))
+	size, err := strconv.Atoi(query.Get("ws.size"))
+	if err != nil || size <= 0 {
+		size = defaultPageSize
+	}
+	if start < 0 || start > len(entries) {
+		start = len(entries)
+	}
+	end := start + size
+	if end > len(entries) {
+		end = len(entries)
+	}
+	page := map[string]interface{}{
+		"total_size":         len(entries),
+		"start":              start,
+		"entries":            entries[start:end],
+		"resource_type_link": q.link("#" + typ + "-page-resource"),
+	}
+	pageLink := func(start int) string {
+		query.Set("ws.start", strconv.Itoa(start))
+		query.Set("ws.size", strconv.Itoa(size))
+		return q.root + strings.TrimPrefix(q.r.URL.Path, "/devel/") + "?" + query.Encode()
+	}
+	if end < len(entries) {
+		page["next_collection_link"] = pageLink(end)
+	}
+	if start > 0 {
+		prev := start - size
+		if prev < 0 {
+			prev = 0
+		}
+		page["prev_collection_link"] = pageLink(prev)
+	}
+	return q.writeJSON(http.StatusOK, page)
+}
+
+// form parses the parameters of a POST request, which may be a multipart upload
+func (q *request) form() error {
+	if strings.HasPrefix(q.r.Header.Get("Content-Type"), "multipart/form-data") {
+		return q.r.ParseMultipartForm(32 << 20)
+	}
+	return q.r.ParseForm()
+}
+
+// required returns a parameter that must be given
+func (q *request) required(key string) (string, error) {
+	value := q.r.FormValue(key)
+	if value == "" {
+		return "", badRequest("%s: Required input is missing.", key)
+	}
+	return value, nil
+}
+
+// list reads a list parameter sent as a JSON list or repeated
+func (q *request) list(key string) []string {
+	var values []string
+	for _, value := range q.r.Form[key] {
+		var items []string
+		if err := json.Unmarshal([]byte(value), &items); err == nil {
+			values = append(values, items...)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// tags reads a list of tags, which may also be separated by spaces
+func (q *request) tags() []string {
+	var tags []string
+	for _, value := range q.list("tags") {
+		tags = append(tags, strings.Fields(value)...)
+	}
+	return tags
+}
+
+// token returns a new random OAuth token or secret
+func token() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func date(t time.Time) string {
+	return t.UTC().Format(dateFormat)
+}
+
+func etag(kind string, id interface{}, revision int) string {
+	return fmt.Sprintf(`"%s-%v-%d"`, kind, id, revision)
+}
+
+// ServeHTTP answers the requests to the API, the OAuth token endpoints and the librarian
+func (l *Launchpad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+	q := &request{w: w, r: r, root: base + "/devel/"}
+	if m := oauthToken.FindStringSubmatch(r.Header.Get("Authorization")); m != nil && m[1] != "" {
+		q.user = l.Me
+	}
+
+	var err error
+	switch path := r.URL.Path; {
+	case path == "/+request-token":
+		err = l.requestToken(q)
+	case path == "/+access-token":
+		err = l.accessToken(q)
+	case path == "/+authorize-token":
+		_, err = io.WriteString(w, "The fake Launchpad authorizes every token by itself.\n")
+	case strings.HasPrefix(path, "/librarian/"):
+		err = l.librarian(q, strings.TrimPrefix(path, "/librarian/"))
+	case strings.HasPrefix(path, "/devel/"):
+		if r.Method != "GET" && q.user == "" {
+			err = errUnauthorized
+		} else {
+			err = l.api(q, strings.Trim(strings.TrimPrefix(path, "/devel/"), "/"))
+		}
+	default:
+		err = errNotFound
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			status = e.status
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(status)
+		io.WriteString(w, err.Error())
+	}
+}
+
+// requestToken issues a request token, which the access token endpoint exchanges without waiting for the user
+func (l *Launchpad) requestToken(q *request) error {
+	if q.r.Method != "POST" {
+		return errMethod
+	}
+	if err := q.form(); err != nil {
+		return badRequest("%v", err)
+	}
+	if q.r.FormValue("oauth_consumer_key") == "" {
+		return &apiError{http.StatusUnauthorized, "Unknown consumer."}
+	}
+	t, secret := token(), token()
+	l.tokens[t] = secret
+	_, err := io.WriteString(q.w, url.Values{"oauth_token": {t}, "oauth_token_secret": {secret}}.Encode())
+	return err
+}
+
+// accessToken exchanges a request token for an access token
+func (l *Launchpad) accessToken(q *request) error {
+	if q.r.Method != "POST" {
+		return errMethod
+	}
+	if err := q.form(); err != nil {
+		return badRequest("%v", err)
+	}
+	t := q.r.FormValue("oauth_token")
+	secret, ok := l.tokens[t]
+	if !ok || q.r.FormValue("oauth_signature") != "&"+secret {
+		return &apiError{http.StatusUnauthorized, "Invalid OAuth signature."}
+	}
+	delete(l.tokens, t)
+	_, err := io.WriteString(q.w, url.Values{"oauth_token": {token()}, "oauth_token_secret": {token()}}.Encode())
+	return err
+}
+
+// librarian serves the content of an attachment at /librarian/ID/filename
+func (l *Launchpad) librarian(q *request, path string) error {
+	parts := strings.SplitN(path, "/", 2)
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) != 2 {
+		return errNotFound
+	}
+	for _, bug := range l.bugs {
+		for _, attachment := range bug.Attachments {
+			if attachment.ID == id && attachment.Filename == parts[1] {
+				contentType := attachment.ContentType
+				if contentType == "" {
+					contentType = "application/octet-stream"
+				}
+				q.w.Header().Set("Content-Type", contentType)
+				q.w.Header().Set("Content-Length", strconv.Itoa(len(attachment.Data)))
+				_, err := q.w.Write(attachment.Data)
+				return err
+			}
+		}
+	}
+	return errNotFound
+}
+
+// api dispatches a request to the resource at path under the service root
+func (l *Launchpad) api(q *request, path string) error {
+	parts := strings.Split(path, "/")
+	method := q.r.Method
+	switch {
+	case path == "":
+		return l.serviceRoot(q)
+	case path == "people/+me":
+		if q.user == "" {
+			return errUnauthorized
+		}
+		http.Redirect(q.w, q.r, q.link("~"+q.user), http.StatusSeeOther)
+		return nil
+	case path == "people" && method == "GET":
+		return q.writeCollection("person", l.peopleEntries(q))
+	case path == "projects" && method == "GET":
+		return q.writeCollection("project", l.pillarEntries(q, false))
+	case path == "distributions" && method == "GET":
+		return q.writeCollection("distribution", l.pillarEntries(q, true))
+	case len(parts) == 1 && strings.HasPrefix(path, "~"):
+		person, ok := l.people[strings.TrimPrefix(path, "~")]
+		if !ok {
+			return errNotFound
+		}
+		if method != "GET" {
+			return errMethod
+		}
+		return q.writeEntry(http.StatusOK, l.personEntry(q, person))
+	case path == "bugs":
+		switch method {
+		case "GET":
+			var entries []map[string]interface{}
+			for _, bug := range l.sortedBugs() {
+				entries = append(entries, l.bugEntry(q, bug))
+			}
+			return q.writeCollection("bug", entries)
+		case "POST":
+			return l.bugsOperation(q)
+		}
+		return errMethod
+	case parts[0] == "bugs":
+		return l.bugResource(q, parts[1:])
+	case len(parts) == 1:
+		pillar, ok := l.pillars[path]
+		if !ok {
+			return errNotFound
+		}
+		return l.pillarResource(q, pillar)
+	case len(parts) == 3 && parts[1] == "+bug":
+		pillar, ok := l.pillars[parts[0]]
+		if !ok {
+			return errNotFound
+		}
+		bug, task := l.findTask(pillar.Name, parts[2])
+		if task == nil {
+			return errNotFound
+		}
+		switch method {
+		case "GET":
+			return q.writeEntry(http.StatusOK, l.taskEntry(q, bug, task))
+		case "PATCH":
+			return l.patchTask(q, bug, task)
+		}
+		return errMethod
+	}
+	return errNotFound
+}
+
+// serviceRoot answers with the links of the top-level collections, or the WADL when it is asked for
+func (l *Launchpad) serviceRoot(q *request) error {
+	if q.r.Method != "GET" {
+		return errMethod
+	}
+	if strings.Contains(q.r.Header.Get("Accept"), "wadl") {
+		if len(l.WADL) == 0 {
+			return &apiError{http.StatusNotAcceptable, "The fake Launchpad has no WADL."}
+		}
+		q.w.Header().Set("Content-Type", "application/vnd.sun.wadl+xml")
+		_, err := q.w.Write(l.WADL)
+		return err
+	}
+	return q.writeJSON(http.StatusOK, map[string]interface{}{
+		"bugs_collection_link":          q.link("bugs"),
+		"distributions_collection_link": q.link("distributions"),
+		"people_collection_link":        q.link("people"),
+		"projects_collection_link":      q.link("projects"),
+		"me_link":                       q.link("people/+me"),
+		"resource_type_link":            q.link("#service-root"),
+	})
+}
+
+func (l *Launchpad) personEntry(q *request, p *Person) map[string]interface{} {
+	return map[string]interface{}{
+		"self_link":          q.link("~" + p.Name),
+		"web_link":           "https://launchpad.net/~" + p.Name,
+		"resource_type_link": q.link("#person"),
+		"http_etag":          etag("person", p.Name, p.Karma),
+		"name":               p.Name,
+		"display_name":       p.DisplayName,
+		"karma":              p.Karma,
+		"is_team":            false,
+	}
+}
+
+func (l *Launchpad) peopleEntries(q *request) []map[string]interface{} {
+	names := make([]string, 0, len(l.people))
+	for name := range l.people {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, l.personEntry(q, l.people[name]))
+	}
+	return entries
+}
+
+// personLink returns the link of a person, or nil for nobody
+func (l *Launchpad) personLink(q *request, name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	return q.link("~" + name)
+}
+
+func (l *Launchpad) pillarEntry(q *request, p *Pillar) map[string]interface{} {
+	typ := "project"
+	if p.Distribution {
+		typ = "distribution"
+	}
+	return map[string]interface{}{
+		"self_link":          q.link(p.Name),
+		"web_link":           "https://launchpad.net/" + p.Name,
+		"resource_type_link": q.link("#" + typ),
+		"http_etag":          etag(typ, p.Name, 0),
+		"name":               p.Name,
+		"display_name":       p.DisplayName,
+		"title":              p.DisplayName,
+	}
+}
+
+func (l *Launchpad) pillarEntries(q *request, distributions bool) []map[string]interface{} {
+	names := make([]string, 0, len(l.pillars))
+	for name, pillar := range l.pillars {
+		if pillar.Distribution == distributions {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	entries := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, l.pillarEntry(q, l.pillars[name]))
+	}
+	return entries
+}
+
+// pillarResource answers the requests to a project or a distribution, which only has searchTasks
+func (l *Launchpad) pillarResource(q *request, pillar *Pillar) error {
+	if q.r.Method != "GET" {
+		return errMethod
+	}
+	switch op := q.r.URL.Query().Get("ws.op"); op {
+	case "":
+		return q.writeEntry(http.StatusOK, l.pillarEntry(q, pillar))
+	case "searchTasks":
+		return l.searchTasks(q, pillar)
+	default:
+		return badRequest("No such operation: %s", op)
+	}
+}
+
+// searchTasks finds the tasks of a pillar by status, importance, tags, assignee and text
+func (l *Launchpad) searchTasks(q *request, pillar *Pillar) error {
+	if err := q.r.ParseForm(); err != nil {
+		return badRequest("%v", err)
+	}
+	status := q.list("status")
+	for _, s := range status {
+		if !contains(statuses, s) {
+			return badRequest("status: Invalid value \"%s\". Acceptable values are: %s", s, strings.Join(statuses, ", "))
+		}
+	}
+	importance := q.list("importance")
+	tags := q.tags()
+	all := q.r.FormValue("tags_combinator") == "All"
+	text := strings.ToLower(q.r.FormValue("search_text"))
+	assignee := q.name(q.r.FormValue("assignee"))
+
+	var entries []map[string]interface{}
+	for _, bug := range l.sortedBugs() {
+		for _, task := range bug.Tasks {
+			if task.Target != pillar.Name {
+				continue
+			}
+			if len(status) > 0 && !contains(status, task.Status) || len(status) == 0 && contains(closedStatuses, task.Status) {
+				continue
+			}
+			if len(importance) > 0 && !contains(importance, task.Importance) {
+				continue
+			}
+			if assignee != "" && "~"+task.Assignee != assignee {
+				continue
+			}
+			if text != "" && !strings.Contains(strings.ToLower(bug.Title+"\n"+bug.Description), text) {
+				continue
+			}
+			if len(tags) > 0 {
+				matched := 0
+				for _, tag := range tags {
+					if contains(bug.Tags, tag) {
+						matched++
+					}
+				}
+				if matched == 0 || all && matched < len(tags) {
+					continue
+				}
+			}
+			entries = append(entries, l.taskEntry(q, bug, task))
+		}
+	}
+	return q.writeCollection("bug_task", entries)
+}
+
+func (l *Launchpad) sortedBugs() []*Bug {
+	bugs := make([]*Bug, 0, len(l.bugs))
+	for _, bug := range l.bugs {
+		bugs = append(bugs, bug)
+	}
+	sort.Slice(bugs, func(i, j int) bool { return bugs[i].ID < bugs[j].ID })
+	return bugs
+}
+
+// findTask returns the task of the bug with the ID in the pillar
+func (l *Launchpad) findTask(pillar string, id string) (*Bug, *BugTask) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, nil
+	}
+	bug, ok := l.bugs[n]
+	if !ok {
+		return nil, nil
+	}
+	for _, task := range bug.Tasks {
+		if task.Target == pillar {
+			return bug, task
+		}
+	}
+	return nil, nil
+}
+
+func (l *Launchpad) bugEntry(q *request, b *Bug) map[string]interface{} {
+	self := fmt.Sprintf("bugs/%d", b.ID)
+	tags := b.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	informationType := "Public"
+	if b.Private {
+		informationType = "Private"
+	}
+	return map[string]interface{}{
+		"self_link":                   q.link(self),
+		"web_link":                    fmt.Sprintf("https://bugs.launchpad.net/bugs/%d", b.ID),
+		"resource_type_link":          q.link("#bug"),
+		"http_etag":                   etag("bug", b.ID, b.revision),
+		"id":                          b.ID,
+		"title":                       b.Title,
+		"description":                 b.Description,
+		"tags":                        tags,
+		"private":                     b.Private,
+		"information_type":            informationType,
+		"owner_link":                  l.personLink(q, b.Owner),
+		"date_created":                date(b.DateCreated),
+		"message_count":               len(b.Messages),
+		"bug_tasks_collection_link":   q.link(self + "/bug_tasks"),
+		"messages_collection_link":    q.link(self + "/messages"),
+		"attachments_collection_link": q.link(self + "/attachments"),
+	}
+}
+
+func (l *Launchpad) taskEntry(q *request, b *Bug, t *BugTask) map[string]interface{} {
+	displayName := t.Target
+	if pillar, ok := l.pillars[t.Target]; ok {
+		displayName = pillar.DisplayName
+	}
+	return map[string]interface{}{
+		"self_link":               q.link(fmt.Sprintf("%s/+bug/%d", t.Target, b.ID)),
+		"web_link":                fmt.Sprintf("https://bugs.launchpad.net/%s/+bug/%d", t.Target, b.ID),
+		"resource_type_link":      q.link("#bug_task"),
+		"http_etag":               etag("bug_task", fmt.Sprintf("%s-%d", t.Target, b.ID), t.revision),
+		"title":                   fmt.Sprintf("Bug #%d in %s: \"%s\"", b.ID, displayName, b.Title),
+		"bug_link":                q.link(fmt.Sprintf("bugs/%d", b.ID)),
+		"target_link":             q.link(t.Target),
+		"bug_target_name":         t.Target,
+		"bug_target_display_name": displayName,
+		"status":                  t.Status,
+		"importance":              t.Importance,
+		"assignee_link":           l.personLink(q, t.Assignee),
+		"owner_link":              l.personLink(q, b.Owner),
+		"date_created":            date(b.DateCreated),
+	}
+}
+
+func (l *Launchpad) messageEntry(q *request, b *Bug, index int) map[string]interface{} {
+	m := b.Messages[index]
+	return map[string]interface{}{
+		"self_link":          q.link(fmt.Sprintf("bugs/%d/messages/%d", b.ID, index)),
+		"resource_type_link": q.link("#message"),
+		"http_etag":          etag("message", fmt.Sprintf("%d-%d", b.ID, index), 0),
+		"subject":            m.Subject,
+		"content":            m.Content,
+		"owner_link":         l.personLink(q, m.Owner),
+		"date_created":       date(m.DateCreated),
+	}
+}
+
+func (l *Launchpad) attachmentEntry(q *request, b *Bug, a *Attachment) map[string]interface{} {
+	self := fmt.Sprintf("bugs/%d/+attachment/%d", b.ID, a.ID)
+	typ := "Unspecified"
+	if a.IsPatch {
+		typ = "Patch"
+	}
+	return map[string]interface{}{
+		"self_link":          q.link(self),
+		"web_link":           fmt.Sprintf("https://bugs.launchpad.net/bugs/%d/+attachment/%d", b.ID, a.ID),
+		"resource_type_link": q.link("#bug_attachment"),
+		"http_etag":          etag("bug_attachment", a.ID, 0),
+		"title":              a.Title,
+		"type":               typ,
+		"data_link":          q.link(self + "/data"),
+		"bug_link":           q.link(fmt.Sprintf("bugs/%d", b.ID)),
+		"message_link":       q.link(fmt.Sprintf("bugs/%d/messages/%d", b.ID, a.Message)),
+	}
+}
+
+// bugResource answers the requests to a bug and the collections and entries below it
+func (l *Launchpad) bugResource(q *request, parts []string) error {
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return errNotFound
+	}
+	bug, ok := l.bugs[id]
+	if !ok {
+		return errNotFound
+	}
+	method := q.r.Method
+	switch {
+	case len(parts) == 1:
+		switch method {
+		case "GET":
+			return q.writeEntry(http.StatusOK, l.bugEntry(q, bug))
+		case "PATCH":
+			return l.patchBug(q, bug)
+		case "POST":
+			return l.bugOperation(q, bug)
+		}
+		return errMethod
+	case method != "GET":
+		return errMethod
+	case len(parts) == 2 && parts[1] == "bug_tasks":
+		var entries []map[string]interface{}
+		for _, task := range bug.Tasks {
+			entries = append(entries, l.taskEntry(q, bug, task))
+		}
+		return q.writeCollection("bug_task", entries)
+	case len(parts) == 2 && parts[1] == "messages":
+		var entries []map[string]interface{}
+		for i := range bug.Messages {
+			entries = append(entries, l.messageEntry(q, bug, i))
+		}
+		return q.writeCollection("message", entries)
+	case len(parts) == 3 && parts[1] == "messages":
+		index, err := strconv.Atoi(parts[2])
+		if err != nil || index < 0 || index >= len(bug.Messages) {
+			return errNotFound
+		}
+		return q.writeEntry(http.StatusOK, l.messageEntry(q, bug, index))
+	case len(parts) == 2 && parts[1] == "attachments":
+		var entries []map[string]interface{}
+		for _, attachment := range bug.Attachments {
+			entries = append(entries, l.attachmentEntry(q, bug, attachment))
+		}
+		return q.writeCollection("bug_attachment", entries)
+	case len(parts) >= 3 && len(parts) <= 4 && parts[1] == "+attachment":
+		for _, attachment := range bug.Attachments {
+			if strconv.Itoa(attachment.ID) != parts[2] {
+				continue
+			}
+			if len(parts) == 3 {
+				return q.writeEntry(http.StatusOK, l.attachmentEntry(q, bug, attachment))
+			}
+			if parts[3] != "data" {
+				break
+			}
+			// The content is served by the librarian
+			librarian := strings.TrimSuffix(q.root, "devel/") + fmt.Sprintf("librarian/%d/%s", attachment.ID, url.PathEscape(attachment.Filename))
+			http.Redirect(q.w, q.r, librarian, http.StatusSeeOther)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// checkETag fails with 412 Precondition Failed when If-Match is not the current ETag
+func (q *request) checkETag(current string) error {
+	if match := q.r.Header.Get("If-Match"); match != "" && match != current {
+		return &apiError{http.StatusPreconditionFailed, "The resource has changed since you last retrieved it."}
+	}
+	return nil
+}
+
+// patchFields decodes the JSON of a PATCH request and rejects the fields that are not writable
+func (q *request) patchFields(entry map[string]interface{}, writable []string) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(q.r.Body).Decode(&fields); err != nil {
+		return nil, badRequest("Expected a JSON object: %v", err)
+	}
+	for key := range fields {
+		if contains(writable, key) {
+			continue
+		}
+		if _, ok := entry[key]; ok {
+			return nil, badRequest("%s: You tried to modify a read-only attribute.", key)
+		}
+		return nil, badRequest("%s: You tried to modify a nonexistent attribute.", key)
+	}
+	return fields, nil
+}
+
+func (l *Launchpad) patchBug(q *request, bug *Bug) error {
+	entry := l.bugEntry(q, bug)
+	if err := q.checkETag(entry["http_etag"].(string)); err != nil {
+		return err
+	}
+	fields, err := q.patchFields(entry, []string{"title", "description", "tags", "private"})
+	if err != nil {
+		return err
+	}
+	changed := *bug
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "title":
+			err = json.Unmarshal(value, &changed.Title)
+		case "description":
+			err = json.Unmarshal(value, &changed.Description)
+		case "tags":
+			err = json.Unmarshal(value, &changed.Tags)
+		case "private":
+			err = json.Unmarshal(value, &changed.Private)
+		}
+		if err != nil {
+			return badRequest("%s: %v", key, err)
+		}
+	}
+	changed.revision++
+	*bug = changed
+	return q.writeEntry(209, l.bugEntry(q, bug))
+}
+
+func (l *Launchpad) patchTask(q *request, bug *Bug, task *BugTask) error {
+	entry := l.taskEntry(q, bug, task)
+	if err := q.checkETag(entry["http_etag"].(string)); err != nil {
+		return err
+	}
+	fields, err := q.patchFields(entry, []string{"status", "importance", "assignee_link"})
+	if err != nil {
+		return err
+	}
+	changed := *task
+	for key, value := range fields {
+		var text *string
+		if err := json.Unmarshal(value, &text); err != nil {
+			return badRequest("%s: %v", key, err)
+		}
+		switch {
+		case key == "assignee_link" && text == nil:
+			changed.Assignee = ""
+		case key == "assignee_link":
+			name := strings.TrimPrefix(q.name(*text), "~")
+			if _, ok := l.people[name]; !ok {
+				return badRequest("assignee_link: No such person: %s", *text)
+			}
+			changed.Assignee = name
+		case text == nil:
+			return badRequest("%s: Missing required value.", key)
+		case key == "status" && !contains(statuses, *text):
+			return badRequest("status: Invalid value \"%s\". Acceptable values are: %s", *text, strings.Join(statuses, ", "))
+		case key == "status":
+			changed.Status = *text
+		case key == "importance" && !contains(importances, *text):
+			return badRequest("importance: Invalid value \"%s\". Acceptable values are: %s", *text, strings.Join(importances, ", "))
+		case key == "importance":
+			changed.Importance = *text
+		}
+	}
+	changed.revision++
+	*task = changed
+	return q.writeEntry(209, l.taskEntry(q, bug, task))
+}
+
+// bugsOperation answers createBug
+func (l *Launchpad) bugsOperation(q *request) error {
+	if err := q.form(); err != nil {
+		return badRequest("%v", err)
+	}
+	if op := q.r.FormValue("ws.op"); op != "createBug" {
+		return badRequest("No such operation: %s", op)
+	}
+	target, err := q.required("target")
+	if err != nil {
+		return err
+	}
+	pillar, ok := l.pillars[q.name(target)]
+	if !ok {
+		return badRequest("target: No such project or distribution: %s", target)
+	}
+	title, err := q.required("title")
+	if err != nil {
+		return err
+	}
+	description, err := q.required("description")
+	if err != nil {
+		return err
+	}
+	bug := l.addBug(Bug{
+		Title:       title,
+		Description: description,
+		Owner:       q.user,
+		Tags:        q.tags(),
+		Private:     q.r.FormValue("private") == "true",
+		Tasks:       []*BugTask{{Target: pillar.Name}},
+	})
+	return q.created(fmt.Sprintf("bugs/%d", bug.ID))
+}
+
+// bugOperation answers the named operations of a bug: newMessage and addAttachment
+func (l *Launchpad) bugOperation(q *request, bug *Bug) error {
+	if err := q.form(); err != nil {
+		return badRequest("%v", err)
+	}
+	switch op := q.r.FormValue("ws.op"); op {
+	case "newMessage":
+		content, err := q.required("content")
+		if err != nil {
+			return err
+		}
+		subject := q.r.FormValue("subject")
+		if subject == "" {
+			subject = "Re: " + bug.Title
+		}
+		bug.Messages = append(bug.Messages, &Message{Owner: q.user, Subject: subject, Content: content, DateCreated: time.Now().UTC()})
+		bug.revision++
+		return q.created(fmt.Sprintf("bugs/%d/messages/%d", bug.ID, len(bug.Messages)-1))
+	case "addAttachment":
+		return l.addAttachment(q, bug)
+	default:
+		return badRequest("No such operation: %s", op)
+	}
+}
+
+// addAttachment stores the uploaded data, sent as a multipart file or as a plain value, with a new message
+func (l *Launchpad) addAttachment(q *request, bug *Bug) error {
+	comment, err := q.required("comment")
+	if err != nil {
+		return err
+	}
+	var data []byte
+	filename := q.r.FormValue("filename")
+	contentType := q.r.FormValue("content_type")
+	if file, header, err := q.r.FormFile("data"); err == nil {
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			return err
+		}
+		if filename == "" {
+			filename = header.Filename
+		}
+		if contentType == "" {
+			contentType = header.Header.Get("Content-Type")
+		}
+	} else if value := q.r.FormValue("data"); value != "" {
+		data = []byte(value)
+	} else {
+		return badRequest("data: Required input is missing.")
+	}
+	if filename == "" {
+		return badRequest("filename: Required input is missing.")
+	}
+	title := q.r.FormValue("description")
+	if title == "" {
+		title = filename
+	}
+	bug.Messages = append(bug.Messages, &Message{Owner: q.user, Subject: "Re: " + bug.Title, Content: comment, DateCreated: time.Now().UTC()})
+	l.lastAttachment++
+	attachment := &Attachment{
+		ID:          l.lastAttachment,
+		Title:       title,
+		Filename:    filename,
+		ContentType: contentType,
+		IsPatch:     q.r.FormValue("is_patch") == "true",
+		Data:        data,
+		Message:     len(bug.Messages) - 1,
+	}
+	bug.Attachments = append(bug.Attachments, attachment)
+	bug.revision++
+	return q.created(fmt.Sprintf("bugs/%d/+attachment/%d", bug.ID, attachment.ID))
+}
@@ -0,0 +1,215 @@
+// Package launchpadtest is a fake Launchpad for testing scripts and clients of the
+// Launchpad API without the network. It keeps an in-memory subset of the API: people,
+// projects and distributions, bugs with their tasks, messages and attachments,
+// searchTasks, the OAuth token endpoints and the librarian serving the attachments.
+//
+// The service root is at /devel/ of the server, so lp-api talks to it with
+// `lp-api -service-root http://127.0.0.1:port/devel/`.
+package launchpadtest
+
+import (
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Person is a Launchpad user or team
+type Person struct {
+	Name        string
+	DisplayName string
+	Karma       int
+}
+
+// Pillar is a project or a distribution, the target of bug tasks
+type Pillar struct {
+	Name         string
+	DisplayName  string
+	Distribution bool
+}
+
+// BugTask tracks a bug in a pillar
+type BugTask struct {
+	// Target is the name of the pillar
+	Target     string
+	Status     string
+	Importance string
+	// Assignee is the name of the assigned person, if any
+	Assignee string
+
+	revision int
+}
+
+// Message is a comment of a bug. The first message of a bug is its description.
+type Message struct {
+	// Owner is the name of the author
+	Owner       string
+	Subject     string
+	Content     string
+	DateCreated time.Time
+}
+
+// Attachment is a file attached to a bug, served by the librarian
+type Attachment struct {
+	ID          int
+	Title       string
+	Filename    string
+	ContentType string
+	IsPatch     bool
+	Data        []byte
+	// Message is the index of the message the attachment was added with
+	Message int
+}
+
+// Bug is a bug report
+type Bug struct {
+	ID          int
+	Title       string
+	Description string
+	// Owner is the name of the reporter
+	Owner       string
+	Tags        []string
+	Private     bool
+	DateCreated time.Time
+	Tasks       []*BugTask
+	Messages    []*Message
+	Attachments []*Attachment
+
+	revision int
+}
+
+// Launchpad is the state of the fake Launchpad and the http.Handler serving it
+type Launchpad struct {
+	// Me is the name of the person authenticated by any OAuth token
+	Me string
+	// WADL is served as the description of the service root when it is not empty
+	WADL []byte
+
+	mu             sync.Mutex
+	people         map[string]*Person
+	pillars        map[string]*Pillar
+	bugs           map[int]*Bug
+	lastBug        int
+	lastAttachment int
+	tokens         map[string]string
+}
+
+// New returns a fake Launchpad with some sample data: the people alice, who is Me,
+// and bob, the ubuntu distribution, the lp-api project and bug 1 with a task on each of them.
+func New() *Launchpad {
+	l := &Launchpad{
+		Me:      "alice",
+		people:  make(map[string]*Person),
+		pillars: make(map[string]*Pillar),
+		bugs:    make(map[int]*Bug),
+		tokens:  make(map[string]string),
+	}
+	l.AddPerson(Person{Name: "alice", DisplayName: "Alice", Karma: 1000})
+	l.AddPerson(Person{Name: "bob", DisplayName: "Bob", Karma: 42})
+	l.AddPillar(Pillar{Name: "ubuntu", DisplayName: "Ubuntu", Distribution: true})
+	l.AddPillar(Pillar{Name: "lp-api", DisplayName: "lp-api"})
+	l.AddBug(Bug{
+		Title:       "Microsoft has a majority market share",
+		Description: "Microsoft has a majority market share in the new desktop PC marketplace.",
+		Owner:       "alice",
+		Tags:        []string{"iso-testing"},
+		DateCreated: time.Date(2004, 8, 20, 0, 0, 0, 0, time.UTC),
+		Tasks: []*BugTask{
+			{Target: "ubuntu", Status: "Confirmed", Importance: "Critical", Assignee: "bob"},
+			{Target: "lp-api", Status: "New", Importance: "Undecided"},
+		},
+	})
+	return l
+}
+
+// AddPerson adds a person, or replaces the one with the same name
+func (l *Launchpad) AddPerson(p Person) *Person {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.people[p.Name] = &p
+	return &p
+}
+
+// AddPillar adds a project or a distribution, or replaces the one with the same name
+func (l *Launchpad) AddPillar(p Pillar) *Pillar {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pillars[p.Name] = &p
+	return &p
+}
+
+// AddBug adds a bug with the next ID. Its description becomes its first message and
+// the tasks without a status or an importance are New and Undecided.
+func (l *Launchpad) AddBug(b Bug) *Bug {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addBug(b)
+}
+
+func (l *Launchpad) addBug(b Bug) *Bug {
+	l.lastBug++
+	b.ID = l.lastBug
+	if b.DateCreated.IsZero() {
+		b.DateCreated = time.Now().UTC()
+	}
+	if b.Owner == "" {
+		b.Owner = l.Me
+	}
+	b.Messages = append([]*Message{{Owner: b.Owner, Subject: b.Title, Content: b.Description, DateCreated: b.DateCreated}}, b.Messages...)
+	for _, task := range b.Tasks {
+		if task.Status == "" {
+			task.Status = "New"
+		}
+		if task.Importance == "" {
+			task.Importance = "Undecided"
+		}
+	}
+	for _, attachment := range b.Attachments {
+		l.lastAttachment++
+		attachment.ID = l.lastAttachment
+	}
+	l.bugs[b.ID] = &b
+	return &b
+}
+
+// Bug returns a copy of the bug with the ID, so that tests can check the changes made through the API
+func (l *Launchpad) Bug(id int) (Bug, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.bugs[id]
+	if !ok {
+		return Bug{}, false
+	}
+	copied := *b
+	copied.Tags = append([]string(nil), b.Tags...)
+	copied.Tasks, copied.Messages, copied.Attachments = nil, nil, nil
+	for _, task := range b.Tasks {
+		t := *task
+		copied.Tasks = append(copied.Tasks, &t)
+	}
+	for _, message := range b.Messages {
+		m := *message
+		copied.Messages = append(copied.Messages, &m)
+	}
+	for _, attachment := range b.Attachments {
+		a := *attachment
+		copied.Attachments = append(copied.Attachments, &a)
+	}
+	return copied, true
+}
+
+// Server is a fake Launchpad listening on a local port, like httptest.Server
+type Server struct {
+	*httptest.Server
+	Launchpad *Launchpad
+}
+
+// NewServer starts a fake Launchpad with the sample data of New. Call Close when done.
+func NewServer() *Server {
+	l := New()
+	return &Server{Server: httptest.NewServer(l), Launchpad: l}
+}
+
+// ServiceRoot returns the service root of the server, such as http://127.0.0.1:port/devel/
+func (s *Server) ServiceRoot() string {
+	return s.URL + "/devel/"
+}
@@ -0,0 +1,201 @@
+package launchpadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// auth is the Authorization header of the requests that need a user
+const auth = `OAuth realm="https://api.launchpad.net/", oauth_consumer_key="test", oauth_token="token", oauth_signature="&secret"`
+
+// do sends a request to the server and returns the status, the Location header and the body
+func do(t *testing.T, method string, url string, header http.Header, body io.Reader) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("Location"), string(data)
+}
+
+func TestSearchTasks(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	for i := 0; i < 4; i++ {
+		s.Launchpad.AddBug(Bug{Title: "Crash", Tags: []string{"jammy"}, Tasks: []*BugTask{{Target: "ubuntu", Importance: "High"}}})
+	}
+	s.Launchpad.AddBug(Bug{Title: "Fixed", Tags: []string{"jammy"}, Tasks: []*BugTask{{Target: "ubuntu", Status: "Fix Released"}}})
+
+	tests := []struct {
+		query     string
+		totalSize int
+		entries   int
+		next      bool
+	}{
+		{"ws.op=searchTasks", 5, 5, false},
+		{"ws.op=searchTasks&ws.size=2", 5, 2, true},
+		{"ws.op=searchTasks&ws.size=2&ws.start=4", 5, 1, false},
+		{"ws.op=searchTasks&tags=jammy", 4, 4, false},
+		{"ws.op=searchTasks&tags=jammy&status=Fix+Released", 1, 1, false},
+		{"ws.op=searchTasks&tags=jammy&tags=iso-testing&tags_combinator=All", 0, 0, false},
+		{"ws.op=searchTasks&importance=Critical&assignee=" + url.QueryEscape(s.ServiceRoot()+"~bob"), 1, 1, false},
+		{"ws.op=searchTasks&search_text=MARKET", 1, 1, false},
+	}
+	for _, tt := range tests {
+		status, _, body := do(t, "GET", s.ServiceRoot()+"ubuntu?"+tt.query, nil, nil)
+		if status != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.query, status, body)
+		}
+		var page struct {
+			TotalSize          int               `json:"total_size"`
+			Entries            []json.RawMessage `json:"entries"`
+			NextCollectionLink string            `json:"next_collection_link"`
+		}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if page.TotalSize != tt.totalSize || len(page.Entries) != tt.entries || (page.NextCollectionLink != "") != tt.next {
+			t.Errorf("%s: total_size = %d, %d entries, next %q", tt.query, page.TotalSize, len(page.Entries), page.NextCollectionLink)
+		}
+	}
+}
+
+func TestPatchETag(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	header := http.Header{"Authorization": {auth}, "Content-Type": {"application/json"}}
+
+	if status, _, _ := do(t, "PATCH", s.ServiceRoot()+"bugs/1", http.Header{}, strings.NewReader(`{"title":"Changed"}`)); status != http.StatusUnauthorized {
+		t.Errorf("anonymous PATCH status = %d", status)
+	}
+
+	_, _, body := do(t, "GET", s.ServiceRoot()+"bugs/1", nil, nil)
+	var bug struct {
+		ETag string `json:"http_etag"`
+	}
+	json.Unmarshal([]byte(body), &bug)
+
+	header.Set("If-Match", bug.ETag)
+	if status, _, body := do(t, "PATCH", s.ServiceRoot()+"bugs/1", header, strings.NewReader(`{"title":"Changed","tags":["focal"]}`)); status != 209 {
+		t.Fatalf("PATCH status = %d %s", status, body)
+	}
+	if b, _ := s.Launchpad.Bug(1); b.Title != "Changed" || len(b.Tags) != 1 || b.Tags[0] != "focal" {
+		t.Errorf("bug after PATCH = %+v", b)
+	}
+	if status, _, _ := do(t, "PATCH", s.ServiceRoot()+"bugs/1", header, strings.NewReader(`{"title":"Again"}`)); status != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale ETag status = %d", status)
+	}
+	header.Del("If-Match")
+	if status, _, body := do(t, "PATCH", s.ServiceRoot()+"bugs/1", header, strings.NewReader(`{"id":2}`)); status != http.StatusBadRequest || !strings.Contains(body, "read-only") {
+		t.Errorf("PATCH of a read-only field = %d %s", status, body)
+	}
+	if status, _, body := do(t, "PATCH", s.ServiceRoot()+"ubuntu/+bug/1", header, strings.NewReader(`{"status":"Triaged","assignee_link":null}`)); status != 209 {
+		t.Errorf("PATCH of a task = %d %s", status, body)
+	}
+	if b, _ := s.Launchpad.Bug(1); b.Tasks[0].Status != "Triaged" || b.Tasks[0].Assignee != "" {
+		t.Errorf("task after PATCH = %+v", b.Tasks[0])
+	}
+}
+
+func TestAddAttachment(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("data", "crash.log")
+	part.Write([]byte("Segmentation fault"))
+	writer.WriteField("ws.op", "addAttachment")
+	writer.WriteField("comment", "The log")
+	writer.Close()
+	header := http.Header{"Authorization": {auth}, "Content-Type": {writer.FormDataContentType()}}
+	status, location, _ := do(t, "POST", s.ServiceRoot()+"bugs/1", header, &body)
+	if status != http.StatusCreated || location != s.ServiceRoot()+"bugs/1/+attachment/1" {
+		t.Fatalf("addAttachment = %d %s", status, location)
+	}
+
+	status, librarian, _ := do(t, "GET", location+"/data", nil, nil)
+	if status != http.StatusSeeOther || !strings.HasSuffix(librarian, "/librarian/1/crash.log") {
+		t.Fatalf("GET data = %d %s", status, librarian)
+	}
+	if _, _, content := do(t, "GET", librarian, nil, nil); content != "Segmentation fault" {
+		t.Errorf("librarian content = %q", content)
+	}
+	b, _ := s.Launchpad.Bug(1)
+	if last := b.Messages[len(b.Messages)-1]; last.Content != "The log" || last.Owner != "alice" {
+		t.Errorf("message of the attachment = %+v", last)
+	}
+}
+
+func TestCreateBug(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	form := url.Values{
+		"ws.op":       {"createBug"},
+		"target":      {s.ServiceRoot() + "lp-api"},
+		"title":       {"Crash on start"},
+		"description": {"Steps"},
+		"tags":        {`["focal","jammy"]`},
+	}
+	header := http.Header{"Authorization": {auth}, "Content-Type": {"application/x-www-form-urlencoded"}}
+	status, location, body := do(t, "POST", s.ServiceRoot()+"bugs", header, strings.NewReader(form.Encode()))
+	if status != http.StatusCreated || location != s.ServiceRoot()+"bugs/2" {
+		t.Fatalf("createBug = %d %s %s", status, location, body)
+	}
+	b, _ := s.Launchpad.Bug(2)
+	if b.Title != "Crash on start" || len(b.Tags) != 2 || b.Tasks[0].Target != "lp-api" || b.Tasks[0].Status != "New" || b.Messages[0].Content != "Steps" {
+		t.Errorf("created bug = %+v", b)
+	}
+
+	form.Del("title")
+	if status, _, body := do(t, "POST", s.ServiceRoot()+"bugs", header, strings.NewReader(form.Encode())); status != http.StatusBadRequest || body != "title: Required input is missing." {
+		t.Errorf("createBug without a title = %d %s", status, body)
+	}
+}
+
+func TestOAuth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+
+	_, _, body := do(t, "POST", s.URL+"/+request-token", header, strings.NewReader("oauth_consumer_key=test&oauth_signature_method=PLAINTEXT&oauth_signature=%26"))
+	request, err := url.ParseQuery(body)
+	if err != nil || request.Get("oauth_token") == "" || request.Get("oauth_token_secret") == "" {
+		t.Fatalf("request token = %q", body)
+	}
+	access := url.Values{"oauth_token": {request.Get("oauth_token")}, "oauth_signature": {"&wrong"}}
+	if status, _, _ := do(t, "POST", s.URL+"/+access-token", header, strings.NewReader(access.Encode())); status != http.StatusUnauthorized {
+		t.Errorf("access token with a wrong signature status = %d", status)
+	}
+	access.Set("oauth_signature", "&"+request.Get("oauth_token_secret"))
+	_, _, body = do(t, "POST", s.URL+"/+access-token", header, strings.NewReader(access.Encode()))
+	if values, _ := url.ParseQuery(body); values.Get("oauth_token") == "" || values.Get("oauth_token_secret") == "" {
+		t.Errorf("access token = %q", body)
+	}
+
+	if status, _, _ := do(t, "GET", s.ServiceRoot()+"people/+me", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("anonymous people/+me status = %d", status)
+	}
+	if status, location, _ := do(t, "GET", s.ServiceRoot()+"people/+me", http.Header{"Authorization": {auth}}, nil); status != http.StatusSeeOther || location != s.ServiceRoot()+"~alice" {
+		t.Errorf("people/+me = %d %s", status, location)
+	}
+}
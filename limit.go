@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseRate returns the number of requests per second of a rate such as 5/s, 100/m or 1000/h. A plain number is per second.
+func parseRate(text string) (float64, error) {
+	count, unit := text, "s"
+	if i := strings.Index(text, "/"); i >= 0 {
+		count, unit = text[:i], text[i+1:]
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("Invalid rate '%s', use a number of requests per second, minute or hour such as 5/s or 100/m.", text)
+	}
+	switch unit {
+	case "s", "sec":
+		return n, nil
+	case "m", "min":
+		return n / 60, nil
+	case "h", "hour":
+		return n / 3600, nil
+	}
+	return 0, fmt.Errorf("Invalid rate '%s', use a number of requests per second, minute or hour such as 5/s or 100/m.", text)
+}
+
+// tokenBucket lets requests through at a steady rate with bursts of up to burst requests
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes a token, waiting for it when the bucket is empty. Tokens are reserved in
+// order, so the requests waiting together are spread over time instead of racing.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// limitedTransport applies -rate and -max-in-flight to the requests of every client of the run
+type limitedTransport struct {
+	next   http.RoundTripper
+	bucket *tokenBucket
+	slots  chan struct{}
+}
+
+// releasingBody gives the slot of a request back once its body is closed, so that downloads count as in flight
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release := func() {}
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-t.slots }) }
+	}
+	if t.bucket != nil {
+		if err := t.bucket.wait(req.Context()); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// limits keeps the limits of the run, which are shared by all the clients and goroutines
+var limits struct {
+	once      sync.Once
+	transport *limitedTransport
+	err       error
+}
+
+// newLimitedTransport returns next limited by -rate and -max-in-flight, or nil without limits
+func newLimitedTransport(next http.RoundTripper) (*limitedTransport, error) {
+	if *rateLimit == "" && *maxInFlight <= 0 {
+		return nil, nil
+	}
+	t := &limitedTransport{next: next}
+	if *rateLimit != "" {
+		rate, err := parseRate(*rateLimit)
+		if err != nil {
+			return nil, err
+		}
+		t.bucket = newTokenBucket(rate, math.Max(1, math.Ceil(rate)))
+	}
+	if *maxInFlight > 0 {
+		t.slots = make(chan struct{}, *maxInFlight)
+	}
+	return t, nil
+}
+
+// withLimits returns next behind the limits of the run
+func withLimits(next http.RoundTripper) (http.RoundTripper, error) {
+	limits.once.Do(func() {
+		limits.transport, limits.err = newLimitedTransport(next)
+	})
+	if limits.err != nil {
+		return nil, limits.err
+	}
+	if limits.transport == nil {
+		return next, nil
+	}
+	return limits.transport, nil
+}
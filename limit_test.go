@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		wantErr bool
+	}{
+		{"5/s", 5, false},
+		{"5", 5, false},
+		{"0.5/sec", 0.5, false},
+		{"120/m", 2, false},
+		{"30/min", 0.5, false},
+		{"3600/h", 1, false},
+		{"0/s", 0, true},
+		{"-1/s", 0, true},
+		{"five/s", 0, true},
+		{"5/d", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRate(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(20, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	// The first token is in the bucket, the 4 others come every 50ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("5 tokens at 20/s took %s, want at least 200ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	slow := newTokenBucket(0.1, 1)
+	slow.wait(ctx)
+	if err := slow.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait() on an empty bucket error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLimitedTransport_maxInFlight(t *testing.T) {
+	var current, highest int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			old := atomic.LoadInt32(&highest)
+			if n <= old || atomic.CompareAndSwapInt32(&highest, old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	transport := &limitedTransport{next: http.DefaultTransport, slots: make(chan struct{}, 2)}
+	client := &http.Client{Transport: transport}
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if highest > 2 {
+		t.Errorf("%d requests were in flight, want at most 2", highest)
+	}
+
+	// A response holds its slot until its body is closed, like a download in progress
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("Do() with all the slots taken by open bodies succeeded")
+	}
+	resp.Body.Close()
+	resp2.Body.Close()
+	if resp, err := client.Get(server.URL); err != nil {
+		t.Errorf("Get() after closing the bodies error = %v", err)
+	} else {
+		resp.Body.Close()
+	}
+}
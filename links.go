@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// meRef is the shorthand reference to the authenticated user
+const meRef = "@me"
+
+// linkParams lists the named operation parameters that usually take a link to another entry.
+// They are only guessed from their names when no WADL is available.
+var linkParams = map[string]bool{
+	"archive":       true,
+	"assignee":      true,
+	"distribution":  true,
+	"distro_series": true,
+	"duplicate_of":  true,
+	"from_archive":  true,
+	"milestone":     true,
+	"owner":         true,
+	"person":        true,
+	"project":       true,
+	"reviewer":      true,
+	"target":        true,
+	"team":          true,
+}
+
+// isLinkParam checks if a parameter takes a link to another entry as its value. Fields ending in "_link"
+// always do, others when the WADL types them as links. wadlType is "" when no WADL is available, and
+// only then are the names of linkParams guessed.
+func isLinkParam(key string, wadlType string) bool {
+	if strings.HasSuffix(key, "_link") {
+		return true
+	}
+	if wadlType != "" {
+		return wadlType == "link"
+	}
+	return linkParams[key]
+}
+
+// meLink caches the link of the authenticated user once it has been looked up
+var meLink string
+
+// Me returns the API link of the authenticated user
+func (lp LaunchpadAPI) Me() (string, error) {
+	if meLink != "" && strings.HasPrefix(meLink, lpAPI) {
+		return meLink, nil
+	}
+	payload, err := lp.getInternal(lpAPI + "people/+me")
+	if err != nil {
+		return "", err
+	}
+	var me struct {
+		SelfLink string `json:"self_link"`
+	}
+	if err := json.Unmarshal([]byte(payload), &me); err != nil {
+		return "", err
+	}
+	if me.SelfLink == "" {
+		return "", errors.New("Unable to find out who " + meRef + " is.")
+	}
+	if *debug {
+		log.Print(meRef, " is ", me.SelfLink)
+	}
+	meLink = me.SelfLink
+	return meLink, nil
+}
+
+// ExpandLink turns a shorthand reference such as ~alice, bugs/123, ubuntu/jammy or @me
+// into an absolute link for the active service root. Absolute URLs are returned unchanged.
+func (lp LaunchpadAPI) ExpandLink(ref string) (string, error) {
+	switch {
+	case ref == "":
+		return ref, nil
+	case strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://"):
+		return ref, nil
+	case ref == meRef:
+		return lp.Me()
+	}
+	return lpAPI + strings.TrimPrefix(ref, "/"), nil
+}
+
+// linkValue resolves the value of a link parameter: @me, a shorthand reference or @file holding one
+func (lp LaunchpadAPI) linkValue(value string) (string, error) {
+	if value == meRef {
+		return lp.Me()
+	}
+	value, err := loadParamValue(value)
+	if err != nil {
+		return "", err
+	}
+	return lp.ExpandLink(value)
+}
+
+// linkParamValue resolves the value of a parameter of the WADL type wadlType, expanding shorthand references for link parameters
+func (lp LaunchpadAPI) linkParamValue(key string, value string, wadlType string) (string, error) {
+	if isLinkParam(key, wadlType) {
+		return lp.linkValue(value)
+	}
+	return loadParamValue(value)
+}
+
+// webVhosts lists the Launchpad web vhosts besides the main site
+var webVhosts = []string{"bugs", "code", "answers", "blueprints", "translations"}
+
+// splitLaunchpadHost splits a Launchpad host name such as bugs.staging.launchpad.net
+// into its vhost ("bugs") and environment ("staging."). ok is false for other hosts.
+func splitLaunchpadHost(host string) (vhost string, env string, ok bool) {
+	if host == "launchpad.net" {
+		return "", "", true
+	}
+	prefix := strings.TrimSuffix(host, ".launchpad.net")
+	if prefix == host {
+		return "", "", false
+	}
+	labels := strings.SplitN(prefix, ".", 2)
+	if labels[0] == "api" {
+		vhost = "api"
+	}
+	for _, name := range webVhosts {
+		if labels[0] == name {
+			vhost = name
+		}
+	}
+	if vhost == "" {
+		return "", prefix + ".", true
+	}
+	if len(labels) == 2 {
+		env = labels[1] + "."
+	}
+	return vhost, env, true
+}
+
+// parseAPIURL splits an API URL into its service root, such as https://api.launchpad.net/devel/, and the resource path
+func parseAPIURL(rawURL string) (root string, resource string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	if vhost, _, ok := splitLaunchpadHost(u.Host); !ok || vhost != "api" {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return "", "", false
+	}
+	root = u.Scheme + "://" + u.Host + "/" + parts[0] + "/"
+	if len(parts) == 2 {
+		resource = parts[1]
+	}
+	if u.RawQuery != "" {
+		resource += "?" + u.RawQuery
+	}
+	return root, resource, true
+}
+
+// WebToAPI maps a Launchpad web URL, from any of its vhosts, to the equivalent API URL and its service root
+func WebToAPI(rawURL string) (apiURL string, root string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	vhost, env, ok := splitLaunchpadHost(u.Host)
+	if !ok || vhost == "api" {
+		return "", "", false
+	}
+	resource := strings.Trim(u.Path, "/")
+	resource = strings.TrimSuffix(resource, "/+index")
+	root = "https://api." + env + "launchpad.net/devel/"
+	return root + resource, root, true
+}
+
+// webVhost picks the web vhost that shows the resource at path
+func webVhost(resource string) string {
+	segments := strings.Split(resource, "/")
+	if segments[0] == "bugs" {
+		return "bugs"
+	}
+	for _, segment := range segments {
+		switch segment {
+		case "+bug", "+bugs":
+			return "bugs"
+		case "+git", "+merge", "+ref", "+branch", "+recipe", "+snap", "+charm-recipe":
+			return "code"
+		case "+question", "+questions":
+			return "answers"
+		case "+spec", "+specs":
+			return "blueprints"
+		case "+pots", "+translations", "+imports":
+			return "translations"
+		}
+	}
+	return ""
+}
+
+// APIToWeb maps a Launchpad API URL to the web page showing the same resource
+func APIToWeb(rawURL string) (string, bool) {
+	root, resource, ok := parseAPIURL(rawURL)
+	if !ok {
+		return "", false
+	}
+	u, _ := url.Parse(root)
+	_, env, _ := splitLaunchpadHost(u.Host)
+	host := env + "launchpad.net"
+	if vhost := webVhost(resource); vhost != "" {
+		host = vhost + "." + host
+	}
+	return u.Scheme + "://" + host + "/" + resource, true
+}
+
+// ResolveResource turns a resource argument into an API URL. Absolute API and web URLs
+// switch the active service root to theirs, anything else is expanded by ExpandLink.
+func (lp LaunchpadAPI) ResolveResource(arg string) (string, error) {
+	if root, _, ok := parseAPIURL(arg); ok {
+		lpAPI = root
+		return arg, nil
+	}
+	if apiURL, root, ok := WebToAPI(arg); ok {
+		if *debug {
+			log.Print("Web URL ", arg, " is ", apiURL)
+		}
+		lpAPI = root
+		return apiURL, nil
+	}
+	resource, err := lp.ExpandLink(arg)
+	if err != nil {
+		return "", err
+	}
+	if resource == "" {
+		resource = lpAPI
+	}
+	return resource, nil
+}
+
+// ConvertURL converts between API and web URLs. Shorthand references are expanded to API URLs.
+func (lp LaunchpadAPI) ConvertURL(arg string) (string, error) {
+	if _, _, ok := parseAPIURL(arg); ok {
+		if webURL, ok := APIToWeb(arg); ok {
+			return webURL, nil
+		}
+	}
+	if apiURL, _, ok := WebToAPI(arg); ok {
+		return apiURL, nil
+	}
+	if strings.HasPrefix(arg, "https://") || strings.HasPrefix(arg, "http://") {
+		return "", errors.New(arg + " is not a Launchpad URL.")
+	}
+	return lp.ExpandLink(arg)
+}
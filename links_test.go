@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestIsLinkParam(t *testing.T) {
+	tests := []struct {
+		key      string
+		wadlType string
+		want     bool
+	}{
+		{"assignee", "", true},
+		{"assignee_link", "", true},
+		{"duplicate_of", "", true},
+		{"milestone_link", "string", true},
+		{"target", "", true},
+		{"owner", "", true},
+		{"status", "", false},
+		{"tags", "", false},
+		{"ws.op", "", false},
+		{"assignee", "link", true},
+		{"distribution", "link", true},
+		{"project", "string", false},
+		{"person", "string", false},
+		{"bug_target", "link", true},
+	}
+
+	for _, tt := range tests {
+		if got := isLinkParam(tt.key, tt.wadlType); got != tt.want {
+			t.Errorf("isLinkParam(%q, %q) = %v, want %v", tt.key, tt.wadlType, got, tt.want)
+		}
+	}
+}
+
+func TestQueryProcess_links(t *testing.T) {
+	backup := lpAPI
+	lpAPI = "https://api.launchpad.net/devel/"
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Cleanup(func() {
+		delete(loadedWADL, lpAPI)
+		lpAPI = backup
+	})
+
+	query := func() url.Values {
+		req, err := http.NewRequest("GET", lpAPI+"bugs/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (LaunchpadAPI{}).QueryProcess(req, []string{"ws.op==isUserAffected", "user==~alice", "project==ubuntu"}); err != nil {
+			t.Fatalf("QueryProcess() error = %v", err)
+		}
+		return req.URL.Query()
+	}
+
+	// Without a WADL the names of the usual link parameters are guessed
+	q := query()
+	if q.Get("user") != "~alice" || q.Get("project") != lpAPI+"ubuntu" {
+		t.Errorf("without WADL, query = %v", q)
+	}
+
+	// With the WADL only the parameters it types as links are expanded
+	data, err := os.ReadFile("testdata/wadl-devel.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := ParseWADL(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedWADL[lpAPI] = w
+	q = query()
+	if q.Get("user") != lpAPI+"~alice" || q.Get("project") != "ubuntu" {
+		t.Errorf("with WADL, query = %v", q)
+	}
+}
+
+func TestExpandLink(t *testing.T) {
+	backup := lpAPI
+	lpAPI = "https://api.staging.launchpad.net/devel/"
+	t.Cleanup(func() { lpAPI = backup })
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"~alice", "https://api.staging.launchpad.net/devel/~alice"},
+		{"bugs/123", "https://api.staging.launchpad.net/devel/bugs/123"},
+		{"ubuntu/jammy", "https://api.staging.launchpad.net/devel/ubuntu/jammy"},
+		{"/ubuntu/+milestone/ubuntu-22.04", "https://api.staging.launchpad.net/devel/ubuntu/+milestone/ubuntu-22.04"},
+		{"https://api.launchpad.net/devel/~bob", "https://api.launchpad.net/devel/~bob"},
+		{"", ""},
+	}
+
+	lp := LaunchpadAPI{}
+	for _, tt := range tests {
+		got, err := lp.ExpandLink(tt.ref)
+		if err != nil {
+			t.Errorf("ExpandLink(%q) error = %v", tt.ref, err)
+		}
+		if got != tt.want {
+			t.Errorf("ExpandLink(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestExpandLink_me(t *testing.T) {
+	var server *httptest.Server
+	requests := 0
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/devel/people/+me":
+			requests++
+			json.NewEncoder(w).Encode(map[string]string{"self_link": server.URL + "/devel/~alice"})
+		case "/devel/bugs/123":
+			body, _ := io.ReadAll(r.Body)
+			var data map[string]interface{}
+			json.Unmarshal(body, &data)
+			json.NewEncoder(w).Encode(data)
+		case "/devel/ubuntu":
+			w.Write([]byte(r.URL.RawQuery))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	backup := lpAPI
+	lpAPI = server.URL + "/devel/"
+	t.Cleanup(func() {
+		lpAPI = backup
+		meLink = ""
+	})
+
+	lp := LaunchpadAPI{}
+	for i := 0; i < 2; i++ {
+		got, err := lp.ExpandLink("@me")
+		if err != nil {
+			t.Fatalf("ExpandLink(@me) error = %v", err)
+		}
+		if got != server.URL+"/devel/~alice" {
+			t.Errorf("ExpandLink(@me) = %q, want %q", got, server.URL+"/devel/~alice")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("people/+me was requested %d times, want 1", requests)
+	}
+
+	payload, err := lp.Patch(lpAPI+"bugs/123", []string{"assignee_link:=@me", `duplicate_of_link:="bugs/1"`, "milestone_link:=null"})
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if data["assignee_link"] != server.URL+"/devel/~alice" {
+		t.Errorf("assignee_link = %v, want %s/devel/~alice", data["assignee_link"], server.URL)
+	}
+	if data["duplicate_of_link"] != server.URL+"/devel/bugs/1" {
+		t.Errorf("duplicate_of_link = %v, want %s/devel/bugs/1", data["duplicate_of_link"], server.URL)
+	}
+	if v, ok := data["milestone_link"]; !ok || v != nil {
+		t.Errorf("milestone_link = %v, want null", v)
+	}
+
+	payload, err = lp.Get(lpAPI+"ubuntu", []string{"ws.op==searchTasks", "assignee==~bob"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	query, _ := url.ParseQuery(payload)
+	if got := query.Get("assignee"); got != server.URL+"/devel/~bob" {
+		t.Errorf("assignee = %q, want %s/devel/~bob", got, server.URL)
+	}
+}
+
+func TestWebToAPI(t *testing.T) {
+	tests := []struct {
+		web  string
+		api  string
+		root string
+	}{
+		{"https://bugs.launchpad.net/ubuntu/+source/linux/+bug/123", "https://api.launchpad.net/devel/ubuntu/+source/linux/+bug/123", "https://api.launchpad.net/devel/"},
+		{"https://bugs.launchpad.net/bugs/1", "https://api.launchpad.net/devel/bugs/1", "https://api.launchpad.net/devel/"},
+		{"https://code.launchpad.net/~u/p/+git/r/+merge/9", "https://api.launchpad.net/devel/~u/p/+git/r/+merge/9", "https://api.launchpad.net/devel/"},
+		{"https://launchpad.net/~team/+archive/ubuntu/ppa", "https://api.launchpad.net/devel/~team/+archive/ubuntu/ppa", "https://api.launchpad.net/devel/"},
+		{"https://answers.launchpad.net/ubuntu/+question/700000/", "https://api.launchpad.net/devel/ubuntu/+question/700000", "https://api.launchpad.net/devel/"},
+		{"https://blueprints.launchpad.net/ubuntu/+spec/foundations-n-plan", "https://api.launchpad.net/devel/ubuntu/+spec/foundations-n-plan", "https://api.launchpad.net/devel/"},
+		{"https://translations.launchpad.net/ubuntu/jammy/+source/glib2.0/+pots/glib20", "https://api.launchpad.net/devel/ubuntu/jammy/+source/glib2.0/+pots/glib20", "https://api.launchpad.net/devel/"},
+		{"https://bugs.staging.launchpad.net/bugs/1923283", "https://api.staging.launchpad.net/devel/bugs/1923283", "https://api.staging.launchpad.net/devel/"},
+		{"https://qastaging.launchpad.net/~alice", "https://api.qastaging.launchpad.net/devel/~alice", "https://api.qastaging.launchpad.net/devel/"},
+	}
+
+	for _, tt := range tests {
+		api, root, ok := WebToAPI(tt.web)
+		if !ok {
+			t.Errorf("WebToAPI(%q) is not recognised", tt.web)
+			continue
+		}
+		if api != tt.api || root != tt.root {
+			t.Errorf("WebToAPI(%q) = %q, %q, want %q, %q", tt.web, api, root, tt.api, tt.root)
+		}
+	}
+
+	for _, notWeb := range []string{"https://api.launchpad.net/devel/bugs/1", "https://example.com/bugs/1", "bugs/1", "~alice"} {
+		if _, _, ok := WebToAPI(notWeb); ok {
+			t.Errorf("WebToAPI(%q) should not be recognised", notWeb)
+		}
+	}
+}
+
+func TestAPIToWeb(t *testing.T) {
+	tests := []struct {
+		api string
+		web string
+	}{
+		{"https://api.launchpad.net/devel/bugs/1", "https://bugs.launchpad.net/bugs/1"},
+		{"https://api.launchpad.net/devel/ubuntu/+source/linux/+bug/123", "https://bugs.launchpad.net/ubuntu/+source/linux/+bug/123"},
+		{"https://api.launchpad.net/devel/~u/p/+git/r/+merge/9", "https://code.launchpad.net/~u/p/+git/r/+merge/9"},
+		{"https://api.launchpad.net/devel/~team/+archive/ubuntu/ppa", "https://launchpad.net/~team/+archive/ubuntu/ppa"},
+		{"https://api.launchpad.net/1.0/ubuntu/+question/700000", "https://answers.launchpad.net/ubuntu/+question/700000"},
+		{"https://api.staging.launchpad.net/devel/~alice", "https://staging.launchpad.net/~alice"},
+	}
+
+	for _, tt := range tests {
+		got, ok := APIToWeb(tt.api)
+		if !ok || got != tt.web {
+			t.Errorf("APIToWeb(%q) = %q, %v, want %q", tt.api, got, ok, tt.web)
+		}
+	}
+}
+
+func TestResolveResource(t *testing.T) {
+	backup := lpAPI
+	t.Cleanup(func() { lpAPI = backup })
+
+	tests := []struct {
+		arg      string
+		resource string
+		root     string
+	}{
+		{"bugs/1", "https://api.launchpad.net/devel/bugs/1", "https://api.launchpad.net/devel/"},
+		{"", "https://api.launchpad.net/devel/", "https://api.launchpad.net/devel/"},
+		{"https://api.staging.launchpad.net/devel/bugs/1", "https://api.staging.launchpad.net/devel/bugs/1", "https://api.staging.launchpad.net/devel/"},
+		{"https://bugs.launchpad.net/ubuntu/+source/linux/+bug/123", "https://api.launchpad.net/devel/ubuntu/+source/linux/+bug/123", "https://api.launchpad.net/devel/"},
+		{"https://api.launchpad.net/1.0/bugs/1", "https://api.launchpad.net/1.0/bugs/1", "https://api.launchpad.net/1.0/"},
+	}
+
+	lp := LaunchpadAPI{}
+	for _, tt := range tests {
+		lpAPI = "https://api.launchpad.net/devel/"
+		got, err := lp.ResolveResource(tt.arg)
+		if err != nil {
+			t.Errorf("ResolveResource(%q) error = %v", tt.arg, err)
+		}
+		if got != tt.resource || lpAPI != tt.root {
+			t.Errorf("ResolveResource(%q) = %q with root %q, want %q with root %q", tt.arg, got, lpAPI, tt.resource, tt.root)
+		}
+	}
+}
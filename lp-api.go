@@ -6,12 +6,12 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/fourdollars/lp-api/lpapi"
 	"github.com/pelletier/go-toml/v2"
 	"io"
 	"io/ioutil"
 	"log"
 	"mime"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
@@ -22,18 +22,27 @@ import (
 	"time"
 )
 
-type Credential struct {
-	Key    string `toml:"oauth_consumer_key"`
-	Token  string `toml:"oauth_token"`
-	Secret string `toml:"oauth_token_secret"`
-}
+// Credential is the OAuth access token of the user
+type Credential = lpapi.Credential
 
 // FileAttachment represents a file to be uploaded to Launchpad
-type FileAttachment struct {
-	Path        string
-	Filename    string
-	ContentType string
-	Data        []byte
+type FileAttachment = lpapi.FileAttachment
+
+// HTTPError is returned when Launchpad answers with a non-2xx status code
+type HTTPError = lpapi.HTTPError
+
+// newStdinAttachment describes the content of stdin, which is streamed at upload time
+func newStdinAttachment() (*FileAttachment, error) {
+	if stdinConsumed {
+		return nil, errors.New("Error: stdin can only be used once")
+	}
+	stdinConsumed = true
+	return &FileAttachment{
+		Path:        "-",
+		Filename:    "stdin",
+		ContentType: "application/octet-stream",
+		Size:        -1,
+	}, nil
 }
 
 // isFileAttachment checks if a parameter value starts with @ indicating a file path
@@ -49,14 +58,16 @@ func extractFilePath(param string) string {
 	return ""
 }
 
-// detectContentType detects MIME type from file extension
-func detectContentType(filepath string) string {
-	ext := strings.ToLower(filepath[strings.LastIndex(filepath, "."):])
-	contentType := mime.TypeByExtension(ext)
-	if contentType == "" {
-		return "application/octet-stream"
-	}
-	return contentType
+// patchExtensions lists the file extensions that are attached as patches by default
+var patchExtensions = map[string]bool{
+	".diff":    true,
+	".patch":   true,
+	".debdiff": true,
+}
+
+// isPatchFile checks if the filename looks like a patch
+func isPatchFile(filename string) bool {
+	return patchExtensions[strings.ToLower(filepath.Ext(filename))]
 }
 
 // readFileContent reads file content from disk into memory
@@ -68,102 +79,178 @@ func readFileContent(filepath string) ([]byte, error) {
 	return data, nil
 }
 
-// buildMultipartBody constructs a multipart/form-data request body with file content and form fields
-func buildMultipartBody(attachment FileAttachment, params map[string]string) (*bytes.Buffer, string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// stdinConsumed records whether a parameter value has already been read from stdin
+var stdinConsumed bool
 
-	// Add file data field
-	part, err := writer.CreateFormFile("data", attachment.Filename)
-	if err != nil {
-		return nil, "", err
+// loadParamValue resolves a command line parameter value.
+// "@path" is replaced with the content of the file at path and "@-" with the content of stdin.
+// A leading "\@" escapes a literal "@" and any other value is returned unchanged.
+func loadParamValue(value string) (string, error) {
+	if strings.HasPrefix(value, "\\@") {
+		return value[1:], nil
 	}
-	if _, err := io.Copy(part, bytes.NewReader(attachment.Data)); err != nil {
-		return nil, "", err
+	if !isFileAttachment(value) {
+		return value, nil
 	}
-
-	// Add other form fields
-	for key, value := range params {
-		if err := writer.WriteField(key, value); err != nil {
-			return nil, "", err
+	filePath := extractFilePath(value)
+	if filePath == "" {
+		return "", errors.New("Error: Missing file path after '@'")
+	}
+	if filePath == "-" {
+		if stdinConsumed {
+			return "", errors.New("Error: stdin can only be used once")
+		}
+		stdinConsumed = true
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("Error: Failed to read stdin: %v", err)
 		}
+		return string(data), nil
 	}
-
-	if err := writer.Close(); err != nil {
-		return nil, "", err
+	data, err := readFileContent(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("Error: File not found: %s", filePath)
+		}
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("Error: Cannot read file: permission denied")
+		}
+		return "", fmt.Errorf("Error: Failed to read file: %v", err)
 	}
-
-	return body, writer.FormDataContentType(), nil
+	return string(data), nil
 }
 
-func (c *Credential) RequestToken(oauth_consumer_key string) error {
-	resp, err := http.PostForm("https://launchpad.net/+request-token",
-		url.Values{
-			"oauth_consumer_key":     {oauth_consumer_key},
-			"oauth_signature_method": {"PLAINTEXT"},
-			"oauth_signature":        {"&"},
-		},
-	)
+// parseJSONParam decodes the JSON value of a key:=value parameter, which may also be loaded from a file
+func parseJSONParam(key string, value string) (interface{}, error) {
+	value, err := loadParamValue(value)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if !json.Valid([]byte(value)) {
+		return nil, invalidJSONError(key, value)
 	}
-	mesg := string(body)
-	if *debug {
-		log.Print(mesg)
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
 	}
-	m, err := url.ParseQuery(mesg)
-	if err != nil {
-		return err
+	return v, nil
+}
+
+// invalidJSONError explains how to pass a JSON value through the shell
+func invalidJSONError(key string, value string) error {
+	return fmt.Errorf("Invalid JSON input for '%s': %s\n"+
+		"The value of key:=value must be JSON, so strings need double quotes and the shell needs single quotes around them, such as %s:='\"%s\"' or tags:='[\"focal\",\"jammy\"]'.",
+		key, value, key, strings.ReplaceAll(value, "'", "'\\''"))
+}
+
+// readJSONObject reads a JSON object from the file at path, or from stdin when path is "-"
+func readJSONObject(path string) (map[string]interface{}, error) {
+	var reader io.Reader
+	if path == "-" {
+		if stdinConsumed {
+			return nil, errors.New("Error: stdin can only be used once")
+		}
+		stdinConsumed = true
+		reader = os.Stdin
+		path = "stdin"
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
 	}
-	c.Key = oauth_consumer_key
-	c.Token = m["oauth_token"][0]
-	c.Secret = m["oauth_token_secret"][0]
-	return nil
+	var object map[string]interface{}
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("Invalid JSON object in %s: %v", path, err)
+	}
+	if object == nil {
+		return nil, fmt.Errorf("Invalid JSON object in %s: null", path)
+	}
+	return object, nil
 }
 
-func (c *Credential) AccessToken() error {
-again:
-	time.Sleep(time.Second)
-	resp, err := http.PostForm("https://launchpad.net/+access-token",
-		url.Values{
-			"oauth_token":            {c.Token},
-			"oauth_consumer_key":     {c.Key},
-			"oauth_signature_method": {"PLAINTEXT"},
-			"oauth_signature":        {"&" + c.Secret},
-		},
-	)
-	if err != nil {
-		return err
+// mergeJSON merges src into dst. Values in src replace the ones in dst, except for objects which are merged recursively.
+func mergeJSON(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		srcObject, srcOK := value.(map[string]interface{})
+		dstObject, dstOK := dst[key].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeJSON(dstObject, srcObject)
+		} else {
+			dst[key] = value
+		}
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+}
+
+// jsonFormValue encodes a typed value as a form value for a named operation.
+// Strings are sent as they are and everything else as compact JSON, which Launchpad decodes on its side.
+func jsonFormValue(v interface{}) (string, error) {
+	if str, ok := v.(string); ok {
+		return str, nil
 	}
-	mesg := string(body)
-	if mesg == "Request token has not yet been reviewed. Try again later." {
-		goto again
-	} else if mesg == "End-user refused to authorize request token." {
-		return errors.New(mesg)
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
 	}
-	if *debug {
-		log.Print(mesg)
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// progressReader reports the progress of reading a body of known length to stderr
+type progressReader struct {
+	io.ReadCloser
+	name   string
+	length int64
+	size   int64
+	prev   int64
+	begin  time.Time
+	last   time.Time
+}
+
+func newProgressReader(body io.ReadCloser, name string, length int64) *progressReader {
+	now := time.Now()
+	fmt.Fprintf(os.Stderr, "Uploading %s ...\n", name)
+	return &progressReader{ReadCloser: body, name: name, length: length, begin: now, last: now}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	now := time.Now()
+	if err == io.EOF {
+		diff := now.Sub(r.begin).Truncate(time.Second)
+		fmt.Fprintf(os.Stderr, "%s (%d bytes took %s) is uploaded.        \n", r.name, r.size, diff)
+	} else if now.Sub(r.last) >= time.Second && r.length > 0 {
+		percent := float64(r.size) / float64(r.length) * 100
+		if r.size-r.prev > 0 {
+			left := time.Duration((r.length-r.size)/(r.size-r.prev)+1) * time.Second
+			fmt.Fprintf(os.Stderr, "%.0f%% (%d/%d bytes) about %s left        \r", percent, r.size, r.length, left)
+		}
+		r.prev = r.size
+		r.last = now
 	}
-	m, err := url.ParseQuery(mesg)
-	if err != nil {
-		return err
+	return n, err
+}
+
+// webRoot returns the Launchpad web site serving the OAuth token endpoints, which is the host of -service-root when it is given
+func webRoot() string {
+	if *serviceRoot != "" {
+		if u, err := url.Parse(*serviceRoot); err == nil && u.Host != "" {
+			return u.Scheme + "://" + u.Host + "/"
+		}
 	}
-	c.Token = m["oauth_token"][0]
-	c.Secret = m["oauth_token_secret"][0]
-	return nil
+	return "https://launchpad.net/"
 }
 
-func (c *Credential) GetCredential() error {
+// getCredential reads the credential from $LAUNCHPAD_TOKEN or -conf, or asks the user to authorize a new one and saves it to -conf
+func getCredential(c *Credential) error {
 	token := os.Getenv("LAUNCHPAD_TOKEN")
 	if token != "" {
 		keys := strings.SplitN(token, ":", 3)
@@ -171,16 +258,23 @@ func (c *Credential) GetCredential() error {
 		c.Token = keys[0]
 		c.Secret = keys[1]
 	} else if _, err := os.Stat(*conf); os.IsNotExist(err) {
-		err = c.RequestToken(*key)
+		client, err := newHTTPClient(*timeout)
 		if err != nil {
 			return err
 		}
+		err = c.RequestToken(client, webRoot(), *key)
+		if err != nil {
+			return err
+		}
+		if *debug {
+			log.Print("Request token " + c.Token)
+		}
 		if strings.HasPrefix(*key, "System-wide: ") {
-			log.Print(fmt.Sprintf("Please open https://launchpad.net/+authorize-token?oauth_token=%s&allow_permission=DESKTOP_INTEGRATION to authorize the token.", c.Token))
+			log.Print(fmt.Sprintf("Please open %s+authorize-token?oauth_token=%s&allow_permission=DESKTOP_INTEGRATION to authorize the token.", webRoot(), c.Token))
 		} else {
-			log.Print(fmt.Sprintf("Please open https://launchpad.net/+authorize-token?oauth_token=%s to authorize the token.", c.Token))
+			log.Print(fmt.Sprintf("Please open %s+authorize-token?oauth_token=%s to authorize the token.", webRoot(), c.Token))
 		}
-		err = c.AccessToken()
+		err = c.AccessToken(client, webRoot())
 		if err != nil {
 			return err
 		}
@@ -189,7 +283,7 @@ func (c *Credential) GetCredential() error {
 			return err
 		}
 		defer fp.Close()
-		err = toml.NewEncoder(fp).Encode(&c)
+		err = toml.NewEncoder(fp).Encode(c)
 		if err != nil {
 			return err
 		}
@@ -198,7 +292,7 @@ func (c *Credential) GetCredential() error {
 		if err != nil {
 			return err
 		}
-		err = toml.Unmarshal([]byte(data), &c)
+		err = toml.Unmarshal([]byte(data), c)
 		if err != nil {
 			return err
 		}
@@ -217,22 +311,43 @@ type LaunchpadAPI struct {
 }
 
 func (lp LaunchpadAPI) SetAuthHeader(header *http.Header) {
-	var timestamp = time.Now().Unix()
-	var auth = fmt.Sprintf("OAuth realm=\"https://api.launchpad.net/\", oauth_consumer_key=\"%s\", oauth_token=\"%s\", oauth_signature=\"&%s\", oauth_nonce=\"%d\", oauth_signature_method=\"PLAINTEXT\", oauth_timestamp=\"%d\", oauth_version=\"1.0\"", lp.Credential.Key, lp.Credential.Token, lp.Credential.Secret, timestamp, timestamp)
+	var auth = lp.Credential.Authorization()
 	if *debug {
 		log.Print(auth)
 	}
 	header.Add("Authorization", auth)
 }
 
-func (lp LaunchpadAPI) QueryProcess(req *http.Request, args []string) {
+// queryParams collects the key==value query parameters from the arguments
+func queryParams(args []string) map[string][]string {
+	params := make(map[string][]string)
+	for _, arg := range args {
+		fields := strings.Split(arg, "==")
+		key := fields[0]
+		if len(fields) > 1 && len(key) > 0 && !strings.Contains(key, "=") {
+			params[key] = append(params[key], strings.Join(fields[1:], "=="))
+		}
+	}
+	return params
+}
+
+func (lp LaunchpadAPI) QueryProcess(req *http.Request, args []string) error {
 	if len(args) > 0 {
 		q := req.URL.Query()
+		resource := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+		wsop := q.Get("ws.op")
+		if values := queryParams(args)["ws.op"]; len(values) > 0 {
+			wsop = values[0]
+		}
 		for _, arg := range args {
 			fields := strings.Split(arg, "==")
 			key := fields[0]
 			value := strings.Join(fields[1:], "==")
 			if len(key) > 0 && !strings.Contains(key, "=") {
+				value, err := lp.linkParamValue(key, value, operationParamType(resource, req.Method, wsop, key))
+				if err != nil {
+					return err
+				}
 				q.Add(key, value)
 			}
 		}
@@ -241,33 +356,95 @@ func (lp LaunchpadAPI) QueryProcess(req *http.Request, args []string) {
 			log.Print("Query: ", req.URL.RawQuery)
 		}
 	}
+	return nil
 }
 
 func (lp LaunchpadAPI) DoProcess(req *http.Request) (string, error) {
-	client := &http.Client{
-		Timeout: *timeout,
-	}
-	resp, err := client.Do(req)
+	payload, _, err := lp.DoRequest(req)
+	return payload, err
+}
+
+// DoRequest sends the request like DoProcess and also returns the response, whose body is already read,
+// for its status and headers such as the Location of a created entry
+func (lp LaunchpadAPI) DoRequest(req *http.Request) (string, *http.Response, error) {
+	body, resp, err := lp.DoStream(req)
 	if err != nil {
-		return "", err
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr.Payload, resp, err
+		}
+		return "", resp, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
 	if err != nil {
-		return "", err
+		return "", resp, err
 	}
-	payload := string(body)
-	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
-	if !statusOK {
-		var msg string
-		if strings.HasPrefix(payload, "Expired token") {
-			msg = payload + "\nPlease remove ~/.config/lp-api.toml if it exists and try it again."
-		} else {
-			msg = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode) + "\n" + payload
+	return string(data), resp, nil
+}
+
+// DoStream sends the request and returns the body of a successful response to be read as it arrives,
+// so that large collections and documents are never held in memory. The caller closes the body.
+// The body of an error response is small and read into the HTTPError.
+func (lp LaunchpadAPI) DoStream(req *http.Request) (io.ReadCloser, *http.Response, error) {
+	if payload, skipped, err := skipRequest(req); skipped || err != nil {
+		if err != nil {
+			return nil, nil, err
 		}
-		return payload, errors.New(msg)
+		return io.NopCloser(strings.NewReader(payload)), nil, nil
 	}
-	return payload, nil
+	client, err := newHTTPClient(*timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	api := lpapi.Client{Credential: lp.Credential, HTTPClient: tracedClient{client}}
+	return api.Do(req)
+}
+
+// newHTTPClient returns a client for the requests to Launchpad. Its transport is shared by the whole
+// process to reuse the connections and to apply -rate and -max-in-flight, and goes through the
+// cassette of -record or -replay and the cache of -cache.
+func newHTTPClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := launchpadTransport()
+	if err != nil {
+		return nil, err
+	}
+	cached, err := withCache(transport)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: cached}, nil
+}
+
+// newDownloadClient returns a client like newHTTPClient for the files of download. It has no overall
+// timeout, see withDownloadTimeouts, and doesn't go through the cache, which is meant for API responses.
+func newDownloadClient() (*http.Client, error) {
+	transport, err := launchpadTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// launchpadTransport returns the shared transport behind the limits of the run and the cassette
+func launchpadTransport() (http.RoundTripper, error) {
+	transport, err := sharedTransport()
+	if err != nil {
+		return nil, err
+	}
+	limited, err := withLimits(transport)
+	if err != nil {
+		return nil, err
+	}
+	return withCassette(limited), nil
+}
+
+// createdLocation returns the link of the entry created by a 201 Created response, or an empty string
+func createdLocation(resp *http.Response) string {
+	if resp == nil || resp.StatusCode != http.StatusCreated {
+		return ""
+	}
+	return resp.Header.Get("Location")
 }
 
 func (lp *LaunchpadAPI) Delete(resource string) (string, error) {
@@ -283,16 +460,49 @@ func (lp *LaunchpadAPI) Delete(resource string) (string, error) {
 }
 
 func (lp *LaunchpadAPI) Get(resource string, args []string) (string, error) {
+	req, err := lp.GetRequest(resource, args)
+	if err != nil {
+		return "", err
+	}
+	return lp.DoProcess(req)
+}
+
+// getInternal gets a resource that lp-api needs on its own behalf, whose headers -i doesn't show
+func (lp *LaunchpadAPI) getInternal(resource string) (string, error) {
+	req, err := lp.GetRequest(resource, nil)
+	if err != nil {
+		return "", err
+	}
+	return lp.DoProcess(internalRequest(req))
+}
+
+// GetStream gets the resource like Get and returns its body to be read as it arrives
+func (lp *LaunchpadAPI) GetStream(resource string, args []string) (io.ReadCloser, error) {
+	req, err := lp.GetRequest(resource, args)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := lp.DoStream(req)
+	return body, err
+}
+
+// GetRequest builds the validated GET request of the resource with the key==value query parameters
+func (lp *LaunchpadAPI) GetRequest(resource string, args []string) (*http.Request, error) {
 	if *debug {
 		log.Print("GET ", resource, " ", args)
 	}
+	if err := lp.ValidateOperation(resource, "GET", queryParams(args)); err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequest("GET", resource, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	lp.SetAuthHeader(&req.Header)
-	lp.QueryProcess(req, args)
-	return lp.DoProcess(req)
+	if err := lp.QueryProcess(req, args); err != nil {
+		return nil, err
+	}
+	return req, nil
 }
 
 func (lp *LaunchpadAPI) Download(fileUrl string) error {
@@ -303,14 +513,20 @@ func (lp *LaunchpadAPI) Download(fileUrl string) error {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *appendOutput {
+		return errors.New("-append can't be used with download.")
+	}
 	filename := path.Base(fileUrl)
-	client := &http.Client{}
+	client, err := newDownloadClient()
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequest("GET", strings.Replace(fileUrl, "https://launchpad.net/", lpAPI, 1), nil)
 	if err != nil {
 		return err
 	}
 	lp.SetAuthHeader(&req.Header)
-	resp, err := client.Do(req)
+	resp, err := withDownloadTimeouts(client, req)
 	if err != nil {
 		return err
 	}
@@ -326,6 +542,9 @@ func (lp *LaunchpadAPI) Download(fileUrl string) error {
 		// If not found in header, use the final URL path (after redirects)
 		filename = path.Base(resp.Request.URL.Path)
 	}
+	if *output != "" {
+		filename = *output
+	}
 
 	length := int64(0)
 	if len(resp.Header["Content-Length"]) == 1 {
@@ -333,17 +552,18 @@ func (lp *LaunchpadAPI) Download(fileUrl string) error {
 	}
 	defer resp.Body.Close()
 	done := make(chan int64)
-	file, err := os.Create(filename)
+	// The file only replaces an existing one once it is complete
+	file, err := createAtomic(filename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	if length != 0 {
-		go func(done chan int64, filename string, length int64) {
+		go func(done chan int64, filename string, partial string, length int64) {
 			var stop bool = false
 			var prev int64 = 0
 			var begin = time.Now()
 			fmt.Printf("Downloading %s ...\n", filename)
-			file, err := os.Open(filename)
+			file, err := os.Open(partial)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -374,42 +594,96 @@ func (lp *LaunchpadAPI) Download(fileUrl string) error {
 				}
 				time.Sleep(time.Second)
 			}
-		}(done, filename, length)
+		}(done, filename, file.Name(), length)
 	}
-	defer file.Close()
 	size, err := io.Copy(file, resp.Body)
+	// The progress stops before the partial file is renamed or removed
 	if length != 0 {
 		done <- size
-	} else {
+	}
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	if length == 0 {
 		fmt.Printf("%s (%d bytes) is downloaded.\n", filename, size)
 	}
-	return err
+	return nil
 }
 
 func (lp *LaunchpadAPI) Patch(resource string, args []string) (string, error) {
 	if *debug {
 		log.Print("PATCH ", resource, " ", args)
 	}
+	// JSON objects from files or stdin come first and key:=value arguments are merged on top of them
 	data := make(map[string]interface{})
-	if len(args) > 0 {
-		for _, arg := range args {
-			fields := strings.Split(arg, ":=")
-			key := fields[0]
-			value := strings.Join(fields[1:], ":=")
-			if len(key) > 0 && !strings.Contains(key, "=") {
-				if json.Valid([]byte(value)) {
-					var v interface{}
-					json.Unmarshal([]byte(value), &v)
-					data[key] = v
-				} else {
-					log.Fatal("Invalid JSON input: " + value)
-				}
+	changes := make(map[string]interface{})
+	var query []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-f" || arg == "--file":
+			if i+1 == len(args) {
+				return "", errors.New("Usage: lp-api patch resource -f changes.json")
+			}
+			i++
+			object, err := readJSONObject(args[i])
+			if err != nil {
+				return "", err
+			}
+			mergeJSON(data, object)
+		case arg == "-":
+			object, err := readJSONObject(arg)
+			if err != nil {
+				return "", err
+			}
+			mergeJSON(data, object)
+		case strings.Contains(arg, ":=") && !strings.Contains(strings.SplitN(arg, ":=", 2)[0], "="):
+			fields := strings.SplitN(arg, ":=", 2)
+			key, value := fields[0], fields[1]
+			if len(key) == 0 {
+				return "", fmt.Errorf("Invalid argument '%s': missing field name before ':='", arg)
+			}
+			v, err := parseJSONParam(key, value)
+			if err != nil && isLinkParam(key, entryFieldType(resource, key)) {
+				// Allow unquoted shorthand references such as assignee_link:=~alice
+				v, err = value, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			changes[key] = v
+		case strings.Contains(arg, "=="):
+			query = append(query, arg)
+		default:
+			return "", fmt.Errorf("Invalid argument '%s' for patch: use key:=json, key==value, -f file.json or - for stdin", arg)
+		}
+	}
+	mergeJSON(data, changes)
+	if len(data) == 0 {
+		return "", errors.New("Nothing to patch. Usage: lp-api patch resource key:=json... or lp-api patch resource -f changes.json")
+	}
+	return lp.PatchEntry(resource, data, query, "")
+}
+
+// PatchEntry sends the changed fields of an entry. Link fields may use shorthand references.
+// When etag is not empty, the change is only applied if the entry still has that ETag.
+func (lp *LaunchpadAPI) PatchEntry(resource string, data map[string]interface{}, query []string, etag string) (string, error) {
+	for key, value := range data {
+		if ref, ok := value.(string); ok && isLinkParam(key, entryFieldType(resource, key)) {
+			link, err := lp.ExpandLink(ref)
+			if err != nil {
+				return "", err
 			}
+			data[key] = link
 		}
 	}
 	payload, err := json.Marshal(data)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	if *debug {
 		log.Print("JSON: ", string(payload))
@@ -419,8 +693,13 @@ func (lp *LaunchpadAPI) Patch(resource string, args []string) (string, error) {
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
 	lp.SetAuthHeader(&req.Header)
-	lp.QueryProcess(req, args)
+	if err := lp.QueryProcess(req, query); err != nil {
+		return "", err
+	}
 	return lp.DoProcess(req)
 }
 
@@ -428,12 +707,23 @@ func (lp *LaunchpadAPI) Put(resource string, jsonFile string) (string, error) {
 	if *debug {
 		log.Print("PUT ", resource, " ", jsonFile)
 	}
-	payload, err := ioutil.ReadFile(jsonFile)
+	var payload []byte
+	var err error
+	if jsonFile == "-" {
+		if stdinConsumed {
+			return "", errors.New("Error: stdin can only be used once")
+		}
+		stdinConsumed = true
+		payload, err = io.ReadAll(os.Stdin)
+		jsonFile = "stdin"
+	} else {
+		payload, err = ioutil.ReadFile(jsonFile)
+	}
 	if err != nil {
-		log.Fatal("Error when opening file: ", err)
+		return "", fmt.Errorf("Error when opening file: %v", err)
 	}
 	if !json.Valid(payload) {
-		log.Fatal("Invalid JSON file: " + jsonFile)
+		return "", errors.New("Invalid JSON file: " + jsonFile)
 	}
 	if *debug {
 		log.Print("JSON: ", string(payload))
@@ -447,14 +737,41 @@ func (lp *LaunchpadAPI) Put(resource string, jsonFile string) (string, error) {
 	return lp.DoProcess(req)
 }
 
+// Post sends a named operation. Factory operations answer with 201 Created and an empty body,
+// so the link of the created entry is returned instead, or the entry itself with -follow.
 func (lp *LaunchpadAPI) Post(resource string, args []string) (string, error) {
+	req, err := lp.PostRequest(resource, args)
+	if err != nil {
+		return "", err
+	}
+	payload, resp, err := lp.DoRequest(req)
+	if err != nil {
+		return payload, err
+	}
+	if location := createdLocation(resp); location != "" {
+		if *follow {
+			return lp.getInternal(location)
+		}
+		return location, nil
+	}
+	return payload, nil
+}
+
+// PostRequest builds the signed POST request for the arguments of Post
+func (lp *LaunchpadAPI) PostRequest(resource string, args []string) (*http.Request, error) {
 	if *debug {
 		log.Print("POST ", resource, " ", args)
 	}
 
-	// Check for file attachment
-	var attachment *FileAttachment
+	// Every @file value that lpapi.IsFilePart picks becomes its own multipart file part
+	var attachments []FileAttachment
 	params := make(map[string]string)
+	wsop := ""
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "ws.op=") && !strings.HasPrefix(arg, "ws.op==") {
+			wsop = strings.TrimPrefix(arg, "ws.op=")
+		}
+	}
 
 	if len(args) > 0 {
 		for _, arg := range args {
@@ -470,68 +787,134 @@ func (lp *LaunchpadAPI) Post(resource string, args []string) (string, error) {
 				value_first = value[0:1]
 			}
 
-			if len(value) > 0 && value_first != "=" && key_last != ":" { // Check if this is a file attachment
-				if key == "attachment" && isFileAttachment(value) {
+			if key_last == ":" && len(key) > 1 && value_first != "=" { // key:=value carries a typed JSON value
+				key = key[:len(key)-1]
+				v, err := parseJSONParam(key, value)
+				if err != nil {
+					return nil, err
+				}
+				if ref, ok := v.(string); ok && isLinkParam(key, operationParamType(resource, "POST", wsop, key)) {
+					v, err = lp.ExpandLink(ref)
+					if err != nil {
+						return nil, err
+					}
+				}
+				params[key], err = jsonFormValue(v)
+				if err != nil {
+					return nil, err
+				}
+			} else if len(value) > 0 && value_first != "=" { // Check if this is a file attachment
+				if isFileAttachment(value) && extractFilePath(value) != "" && lpapi.IsFilePart(extractFilePath(value), operationParamType(resource, "POST", wsop, key)) {
 					filePath := extractFilePath(value)
 
-					// Read file content
-					data, err := readFileContent(filePath)
+					// Only look at the file here; its content is streamed when the request is sent
+					var attachment *FileAttachment
+					var err error
+					if filePath == "-" {
+						attachment, err = newStdinAttachment()
+					} else {
+						attachment, err = lpapi.NewFileAttachment(filePath)
+					}
 					if err != nil {
 						if os.IsNotExist(err) {
-							return "", fmt.Errorf("Error: File not found: %s", filePath)
+							return nil, fmt.Errorf("Error: File not found: %s", filePath)
 						}
 						if os.IsPermission(err) {
-							return "", fmt.Errorf("Error: Cannot read file: permission denied")
+							return nil, fmt.Errorf("Error: Cannot read file: permission denied")
 						}
-						return "", fmt.Errorf("Error: Failed to read file: %v", err)
+						return nil, fmt.Errorf("Error: Failed to read file: %v", err)
 					}
 
-					attachment = &FileAttachment{
-						Path:        filePath,
-						Filename:    filepath.Base(filePath),
-						ContentType: detectContentType(filePath),
-						Data:        data,
+					// 'attachment' is kept as an alias of the 'data' field of addAttachment
+					attachment.Field = key
+					if key == "attachment" {
+						attachment.Field = "data"
 					}
+					attachments = append(attachments, *attachment)
 
 					if *debug {
-						log.Printf("Detected file attachment: %s (%s, %d bytes)", attachment.Filename, attachment.ContentType, len(attachment.Data))
+						log.Printf("Detected file attachment: %s=%s (%s, %d bytes)", attachment.Field, attachment.Filename, attachment.ContentType, attachment.Size)
 					}
 				} else {
+					value, err := lp.linkParamValue(key, value, operationParamType(resource, "POST", wsop, key))
+					if err != nil {
+						return nil, err
+					}
 					params[key] = value
 				}
 			}
 		}
 	}
 
-	var req *http.Request
-	var err error
-
-	// If we have a file attachment, use multipart/form-data
-	if attachment != nil {
-		// Ensure filename parameter is included (required by Launchpad API)
-		if _, ok := params["filename"]; !ok {
-			params["filename"] = attachment.Filename
+	if len(attachments) > 0 {
+		// An explicit content_type describes the main (first) file
+		if contentType, ok := params["content_type"]; ok && contentType != "" {
+			attachments[0].ContentType = contentType
 		}
 
-		// Check if comment is provided (required by Launchpad API)
-		if _, ok := params["comment"]; !ok {
-			return "", fmt.Errorf("Error: 'comment' parameter is required when attaching files")
+		if params["ws.op"] == "addAttachment" {
+			// Ensure filename parameter is included (required by Launchpad API)
+			if _, ok := params["filename"]; !ok {
+				params["filename"] = attachments[0].Filename
+			}
+
+			// Mark patches as such unless told otherwise
+			if _, ok := params["is_patch"]; !ok && isPatchFile(params["filename"]) {
+				params["is_patch"] = "true"
+			}
+
+			// Check if comment is provided (required by Launchpad API)
+			if _, ok := params["comment"]; !ok {
+				return nil, fmt.Errorf("Error: 'comment' parameter is required when attaching files")
+			}
 		}
+	}
+
+	fields := queryParams(args)
+	for key, value := range params {
+		fields[key] = append(fields[key], value)
+	}
+	for _, attachment := range attachments {
+		fields[attachment.Field] = append(fields[attachment.Field], attachment.Filename)
+	}
+	if err := lp.ValidateOperation(resource, "POST", fields); err != nil {
+		return nil, err
+	}
 
-		body, contentType, err := buildMultipartBody(*attachment, params)
+	var req *http.Request
+	var err error
+
+	// If we have file attachments, use multipart/form-data
+	if len(attachments) > 0 {
+		body, contentType, length, err := lpapi.MultipartBody(attachments, params)
 		if err != nil {
-			return "", fmt.Errorf("Error: Failed to build multipart body: %v", err)
+			if os.IsPermission(err) {
+				return nil, fmt.Errorf("Error: Cannot read file: permission denied")
+			}
+			return nil, fmt.Errorf("Error: Failed to build multipart body: %v", err)
 		}
 
 		if *debug {
-			log.Print("Using multipart/form-data for file upload")
+			log.Printf("Using multipart/form-data for %d file(s) (%d bytes)", len(attachments), length)
 		}
 
+		name := attachments[0].Filename
+		if len(attachments) > 1 {
+			name = fmt.Sprintf("%d files", len(attachments))
+		}
+		if !*dryRun && !*asCurl {
+			body = newProgressReader(body, name, length)
+		}
 		req, err = http.NewRequest("POST", resource, body)
 		if err != nil {
-			return "", err
+			body.Close()
+			return nil, err
+		}
+		if length >= 0 {
+			req.ContentLength = length
 		}
 		req.Header.Set("Content-Type", contentType)
+		req = withMultipartForm(req, attachments, params)
 	} else {
 		// Regular form-encoded POST
 		data := url.Values{}
@@ -545,48 +928,107 @@ func (lp *LaunchpadAPI) Post(resource string, args []string) (string, error) {
 
 		req, err = http.NewRequest("POST", resource, strings.NewReader(data.Encode()))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
 
-	lp.QueryProcess(req, args)
+	if err := lp.QueryProcess(req, args); err != nil {
+		return nil, err
+	}
 	lp.SetAuthHeader(&req.Header)
-	return lp.DoProcess(req)
+	return req, nil
 }
 
-func (lp *LaunchpadAPI) Pipe(node string) (string, error) {
-	bytes, err := io.ReadAll(os.Stdin)
+// Pipe gets the link in the node key of the JSON entry read from stdin and returns its body to be read as it arrives
+func (lp *LaunchpadAPI) Pipe(node string) (io.ReadCloser, error) {
+	apiUrl, err := pipeLink(os.Stdin, node)
 	if err != nil {
-		return "", err
-	}
-	var v map[string]interface{}
-	json.Unmarshal(bytes, &v)
-	if v[node] == nil {
-		return "", errors.New("There is no such '" + node + "' key.")
-	}
-	if *debug {
-		log.Print("PIPE ", v[node])
-	}
-	apiUrl, ok := v[node].(string)
-	if !ok {
-		return "", errors.New("The value of '" + node + "' key is not string.")
+		return nil, err
 	}
 	req, err := http.NewRequest("GET", apiUrl, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	lp.SetAuthHeader(&req.Header)
-	return lp.DoProcess(req)
+	body, _, err := lp.DoStream(req)
+	return body, err
+}
+
+// pipeLink decodes the top-level keys of a JSON entry one by one and returns the string value of
+// node as soon as it is found, without holding the other values such as large descriptions in memory
+func pipeLink(r io.Reader, node string) (string, error) {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return "", errors.New("There is no such '" + node + "' key.")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if token != node {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return "", err
+			}
+			continue
+		}
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return "", err
+		}
+		if *debug {
+			log.Print("PIPE ", value)
+		}
+		if value == nil {
+			break
+		}
+		link, ok := value.(string)
+		if !ok {
+			return "", errors.New("The value of '" + node + "' key is not string.")
+		}
+		return link, nil
+	}
+	return "", errors.New("There is no such '" + node + "' key.")
 }
 
+var appendOutput = flag.Bool("append", false, "Append the result to the -output file as one line, compacting JSON, to accumulate NDJSON across runs.")
+var asCurl = flag.Bool("as-curl", false, "Print the write requests as curl command lines instead of sending them.")
+var caBundle = flag.String("ca-bundle", "", "A PEM file of certificate authorities to trust besides the system ones, such as the one of a corporate proxy.")
 var conf = flag.String("conf", os.Getenv("HOME")+"/.config/lp-api.toml", "Specify the Launchpad API config file.")
+var connectTimeout = flag.Duration("connect-timeout", 10*time.Second, "Timeout for connecting to Launchpad, including the TLS handshake.")
 var debug = flag.Bool("debug", false, "Show debug messages")
+var downloadIdleTimeout = flag.Duration("download-idle-timeout", time.Minute, "Abort downloads that receive nothing for this long.")
+var dryRun = flag.Bool("dry-run", false, "Print the write requests (post, patch, put and delete) instead of sending them.")
+var follow = flag.Bool("follow", false, "Get and print the entry created by post instead of its URL.")
 var help = flag.Bool("help", false, "Show help")
+var include = flag.Bool("i", false, "Include the status line and the response headers of the command before the body.")
 var key = flag.String("key", "System-wide: golang (https://github.com/fourdollars/lp-api)", "Specify the OAuth Consumer Key.")
 var lpAPI = "https://api.launchpad.net/devel/"
-var output = flag.String("output", "", "Specify the output file.")
+var maxAge = flag.Duration("max-age", 0, "With -cache, use the cached responses younger than this without asking Launchpad.")
+var maxInFlight = flag.Int("max-in-flight", 0, "Limit the requests in progress at the same time, downloads included, or 0 for no limit.")
+var noValidate = flag.Bool("no-validate", false, "Send named operations without checking them and their parameters against the WADL.")
+var output = flag.String("output", "", "Specify the output file, replaced atomically once the result is complete. It also names the file of download.")
+var outputMode = flag.String("output-mode", "", "The permissions of the files written by -output and download, in octal such as 0600. By default a replaced file keeps its permissions and a new one gets 0666 less the umask.")
+var rateLimit = flag.String("rate", "", "Limit the requests of the whole run to this rate, such as 5/s, 100/m or 1000/h.")
+var record = flag.String("record", "", "Save the HTTP requests and responses to the cassette file, with the secrets redacted.")
+var replay = flag.String("replay", "", "Answer the HTTP requests from the cassette file saved by -record.")
+var serviceRoot = flag.String("service-root", "", "Use the Launchpad API at this service root, such as the one of `lp-api mock-server`.")
 var staging = flag.Bool("staging", false, "Use Launchpad staging server.")
+var strict = flag.Bool("strict", false, "With -replay, fail on requests that are not in the cassette instead of sending them.")
 var timeout = flag.Duration("timeout", 10*time.Second, "Timeout for Launchpad API requests.")
+var useCache = flag.Bool("cache", false, "Keep the GET responses in $XDG_CACHE_HOME/lp-api/http and revalidate them with their ETag or Last-Modified.")
+var verbose = flag.Bool("v", false, "Show the requests, their headers and the timings of the connections on stderr.")
+var wadlExpiry = flag.Duration("wadl-expiry", 7*24*time.Hour, "How long the cached WADL description of the API is used before it is fetched again.")
+
+// fatal saves the cassette of -record, which the deferred calls of main would miss, and exits like log.Fatal
+func fatal(err error) {
+	if err := saveCassettes(); err != nil {
+		log.Print(err)
+	}
+	log.Fatal(err)
+}
 
 func main() {
 	flag.Parse()
@@ -597,76 +1039,140 @@ func main() {
 	if *staging {
 		lpAPI = "https://api.staging.launchpad.net/devel/"
 	}
+	if *serviceRoot != "" {
+		lpAPI = strings.TrimSuffix(*serviceRoot, "/") + "/"
+	}
 	args := flag.Args()
+	if len(args) > 0 && args[0] == "__complete" {
+		// Called by the completion scripts, so it must stay quiet and never talk to Launchpad
+		for _, candidate := range Complete(args[1:]) {
+			fmt.Println(candidate)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "__generate-client" {
+		// Run by go generate in lpclient
+		if err := generateClientCommand(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "mock-server" {
+		if err := mockServerCommand(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "cache" {
+		if err := cacheCommand(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "completion" {
+		shell := ""
+		if len(args) > 1 {
+			shell = args[1]
+		}
+		script, err := CompletionScript(shell)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(script)
+		return
+	}
 	if len(args) == 0 {
-		fmt.Println("Usage: lp-api {get,patch,put,post,delete} resource, such as `lp-api get people/+me` or `lp-api get bugs/1`.\n\tCheck api.html generated by `lp-api get / > api.html` for details.")
+		fmt.Println("Usage: lp-api {get,patch,put,post,call,delete,edit,download,url,describe,completion,mock-server,cache} resource, such as `lp-api get people/+me` or `lp-api get bugs/1`.\n\tRun `lp-api describe bugs/1` or `lp-api describe bug newMessage` for details.")
 		flag.Usage()
 		os.Exit(0)
 	} else if len(args) == 1 && !strings.HasPrefix(args[0], ".") {
-		fmt.Println("Usage: lp-api {get,patch,put,post,delete} resource, such as `lp-api get people/+me` or `lp-api get bugs/1`.\n\tCheck api.html generated by `lp-api get / > api.html` for details.")
+		fmt.Println("Usage: lp-api {get,patch,put,post,call,delete,edit,download,url,describe,completion,mock-server,cache} resource, such as `lp-api get people/+me` or `lp-api get bugs/1`.\n\tRun `lp-api describe bugs/1` or `lp-api describe bug newMessage` for details.")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	// The cassette of -record is saved once the requests are done
+	defer func() {
+		if err := saveCassettes(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
 	lp := LaunchpadAPI{}
 	c := Credential{}
-	err := c.GetCredential()
+	if args[0] == "url" && args[1] != meRef {
+		// Converting URLs doesn't need to talk to Launchpad
+		converted, err := lp.ConvertURL(args[1])
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(converted)
+		return
+	}
+	err := getCredential(&c)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	lp.Credential = c
 
 	var resource string
-	if len(args) == 1 {
-		resource = ""
-	} else if strings.HasPrefix(args[1], "https://api.launchpad.net/devel/") {
-		resource = args[1]
-		lpAPI = "https://api.launchpad.net/devel/"
-	} else if strings.HasPrefix(args[1], "https://api.staging.launchpad.net/devel/") {
-		resource = args[1]
-		lpAPI = "https://api.staging.launchpad.net/devel/"
-	} else {
-		resource = lpAPI + args[1]
+	if len(args) > 1 {
+		resource, err = lp.ResolveResource(args[1])
+		if err != nil {
+			fatal(err)
+		}
 	}
 
 	var payload string
+	var body io.ReadCloser
 
 	switch method := args[0]; {
 	case method == "delete":
 		payload, err = lp.Delete(resource)
 	case method == "get":
-		payload, err = lp.Get(resource, args[2:])
+		body, err = lp.GetStream(resource, args[2:])
 	case method == "patch":
 		payload, err = lp.Patch(resource, args[2:])
 	case method == "put":
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "Usage: lp-api put resource file.json, or lp-api put resource - to read the JSON representation from stdin.")
+			os.Exit(1)
+		}
 		payload, err = lp.Put(resource, args[2])
 	case method == "post":
 		payload, err = lp.Post(resource, args[2:])
+	case method == "call":
+		payload, err = lp.Call(resource, args[2:])
 	case method == "download":
-		err = lp.Download(args[1])
+		// The file is written by Download itself, from the URL the argument resolves to like any resource
+		if err := lp.Download(resource); err != nil {
+			fatal(err)
+		}
+		return
+	case method == "edit":
+		payload, err = lp.Edit(resource, args[2:])
+	case method == "url":
+		payload, err = lp.ConvertURL(args[1])
+	case method == "describe":
+		payload, err = lp.Describe(args[1], resource, args[2:])
 	case strings.HasPrefix(method, ".") && len(args) == 1:
-		payload, err = lp.Pipe(args[0][1:])
+		body, err = lp.Pipe(args[0][1:])
 	default:
 		fmt.Printf("'%s' method is not supported.\n", method)
 		os.Exit(1)
 	}
 	if err != nil {
-		log.Fatal(err)
+		// The payload of an error response goes to stderr, and so do its headers
+		os.Stderr.Write(includedHead())
+		fatal(err)
 	}
-	if *output != "" {
-		if *debug {
-			log.Print("OUTPUT: " + payload)
-		}
-		file, err := os.Create(*output)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer file.Close()
-		_, err = file.WriteString(payload)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		fmt.Println(payload)
+	if body == nil {
+		body = io.NopCloser(strings.NewReader(payload))
+	}
+	body = withIncluded(body)
+	defer body.Close()
+	if err := writeOutput(body); err != nil {
+		fatal(err)
 	}
 }
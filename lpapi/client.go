@@ -0,0 +1,206 @@
+package lpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HTTPError is returned when Launchpad answers with a non-2xx status code
+type HTTPError struct {
+	StatusCode int
+	Payload    string
+}
+
+func (e *HTTPError) Error() string {
+	if strings.HasPrefix(e.Payload, "Expired token") {
+		return e.Payload + "\nPlease remove ~/.config/lp-api.toml if it exists and try it again."
+	}
+	return strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode) + "\n" + e.Payload
+}
+
+// Doer sends HTTP requests, such as *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client sends requests to Launchpad signed with its credential. Get and Post take their
+// arguments in the syntax of the lp-api command line, which makes Client a Transport of lpclient.
+type Client struct {
+	Credential Credential
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient Doer
+}
+
+// NewRequest returns a request to resource signed with the credential of the client
+func (c *Client) NewRequest(method string, resource string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, resource, body)
+	if err != nil {
+		return nil, err
+	}
+	c.Credential.Sign(req)
+	return req, nil
+}
+
+// Do sends the request and returns the body of a successful response to be read as it arrives.
+// The caller closes the body. The body of an error response is small and read into the HTTPError.
+func (c *Client) Do(req *http.Request) (io.ReadCloser, *http.Response, error) {
+	doer := c.HTTPClient
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, resp, err
+		}
+		return nil, resp, &HTTPError{StatusCode: resp.StatusCode, Payload: string(body)}
+	}
+	return resp.Body, resp, nil
+}
+
+// send sends the request and reads the response. For a 201 Created response, it returns the link of the created entry.
+func (c *Client) send(req *http.Request) (string, error) {
+	body, resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusCreated && resp.Header.Get("Location") != "" {
+		return resp.Header.Get("Location"), nil
+	}
+	return string(data), nil
+}
+
+// unescape drops the backslash of a value starting with \@, which is a literal @ rather than a file
+func unescape(value string) string {
+	if strings.HasPrefix(value, "\\@") {
+		return value[1:]
+	}
+	return value
+}
+
+// withQuery adds the key==value arguments to the query of the resource
+func withQuery(resource string, args []string) (string, error) {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for _, arg := range args {
+		if key, value, ok := strings.Cut(arg, "=="); ok && key != "" && !strings.Contains(key, "=") {
+			q.Add(key, unescape(value))
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Get gets the resource with the key==value query parameters and returns the body of the response
+func (c *Client) Get(resource string, args []string) (string, error) {
+	resource, err := withQuery(resource, args)
+	if err != nil {
+		return "", err
+	}
+	req, err := c.NewRequest("GET", resource, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.send(req)
+}
+
+// formValue returns the form value of a key:=json argument. Strings are sent as they are and
+// other values as compact JSON.
+func formValue(key string, text string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return "", fmt.Errorf("Invalid JSON for '%s': %v", key, err)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Post posts the arguments to the resource: key=value and key:=json form values, key=@file uploads of
+// the file and key==value query parameters. It returns the body of the response, or the link of the
+// created entry for a 201 Created response.
+func (c *Client) Post(resource string, args []string) (string, error) {
+	resource, err := withQuery(resource, args)
+	if err != nil {
+		return "", err
+	}
+	params := make(map[string]string)
+	var attachments []FileAttachment
+	for _, arg := range args {
+		if key, value, ok := strings.Cut(arg, ":="); ok && !strings.Contains(key, "=") {
+			if params[key], err = formValue(key, value); err != nil {
+				return "", err
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || strings.HasPrefix(value, "=") {
+			continue
+		}
+		// Without the WADL every @file value is uploaded as a file part
+		if !strings.HasPrefix(value, "@") || !IsFilePart(value[1:], "") {
+			params[key] = unescape(value)
+			continue
+		}
+		var attachment *FileAttachment
+		if value == "@-" {
+			attachment = &FileAttachment{Path: "-", Filename: "stdin", ContentType: "application/octet-stream", Size: -1}
+		} else if attachment, err = NewFileAttachment(value[1:]); err != nil {
+			return "", err
+		}
+		attachment.Field = key
+		attachments = append(attachments, *attachment)
+	}
+
+	var req *http.Request
+	if len(attachments) > 0 {
+		body, contentType, length, err := MultipartBody(attachments, params)
+		if err != nil {
+			return "", err
+		}
+		if req, err = c.NewRequest("POST", resource, body); err != nil {
+			body.Close()
+			return "", err
+		}
+		if length >= 0 {
+			req.ContentLength = length
+		}
+		req.Header.Set("Content-Type", contentType)
+	} else {
+		data := url.Values{}
+		for key, value := range params {
+			data.Set(key, value)
+		}
+		if req, err = c.NewRequest("POST", resource, strings.NewReader(data.Encode())); err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.send(req)
+}
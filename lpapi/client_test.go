@@ -0,0 +1,90 @@
+package lpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fourdollars/lp-api/launchpadtest"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredential_tokens(t *testing.T) {
+	s := launchpadtest.NewServer()
+	defer s.Close()
+
+	var c Credential
+	if err := c.RequestToken(nil, s.URL+"/", "lp-api test"); err != nil {
+		t.Fatalf("RequestToken() error = %v", err)
+	}
+	requestToken := c.Token
+	if err := c.AccessToken(nil, s.URL+"/"); err != nil {
+		t.Fatalf("AccessToken() error = %v", err)
+	}
+	if c.Key != "lp-api test" || c.Token == "" || c.Token == requestToken || c.Secret == "" {
+		t.Errorf("credential = %+v, want an access token of lp-api test", c)
+	}
+
+	if err := (&Credential{}).RequestToken(nil, s.URL+"/", ""); err == nil {
+		t.Error("RequestToken() without a consumer key succeeded")
+	}
+}
+
+func TestCredential_Authorization(t *testing.T) {
+	auth := Credential{Key: "lp-api", Token: "token", Secret: "secret"}.Authorization()
+	for _, want := range []string{`OAuth realm="https://api.launchpad.net/"`, `oauth_consumer_key="lp-api"`, `oauth_token="token"`, `oauth_signature="&secret"`, `oauth_signature_method="PLAINTEXT"`} {
+		if !strings.Contains(auth, want) {
+			t.Errorf("Authorization() = %s, want %s in it", auth, want)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := launchpadtest.NewServer()
+	defer s.Close()
+	c := &Client{Credential: Credential{Key: "lp-api", Token: "token", Secret: "secret"}}
+
+	payload, err := c.Get(s.ServiceRoot()+"bugs/1", nil)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	var bug struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &bug); err != nil || bug.ID != 1 {
+		t.Errorf("Get(bugs/1) = %s", payload)
+	}
+
+	payload, err = c.Get(s.ServiceRoot()+"bugs", []string{"ws.op==searchTasks", "ws.size==1"})
+	if err != nil || !strings.Contains(payload, `"total_size"`) {
+		t.Errorf("Get(searchTasks) = %s, %v", payload, err)
+	}
+
+	location, err := c.Post(s.ServiceRoot()+"bugs/1", []string{"ws.op=newMessage", `content:="Thanks"`, `subject=\@me`})
+	if err != nil || !strings.HasPrefix(location, s.ServiceRoot()+"bugs/1/messages/") {
+		t.Errorf("Post(newMessage) = %s, %v, want the link of the message", location, err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "crash.log"), []byte("Segmentation fault"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Post(s.ServiceRoot()+"bugs/1", []string{"ws.op=addAttachment", "data=@" + filepath.Join(dir, "crash.log"), "comment=Log"}); err != nil {
+		t.Fatalf("Post(addAttachment) error = %v", err)
+	}
+	b, _ := s.Launchpad.Bug(1)
+	if subject := b.Messages[1].Subject; subject != "@me" {
+		t.Errorf("subject = %q, want @me", subject)
+	}
+	if n := len(b.Attachments); n != 1 || b.Attachments[0].Filename != "crash.log" || string(b.Attachments[0].Data) != "Segmentation fault" {
+		t.Errorf("attachments = %+v, want crash.log", b.Attachments)
+	}
+
+	_, err = (&Client{}).Post(s.ServiceRoot()+"bugs/1", []string{"ws.op=newMessage", "content=Anonymous"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Post() without a credential error = %v, want 401", err)
+	}
+}
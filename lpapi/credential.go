@@ -0,0 +1,102 @@
+// Package lpapi signs and sends requests to the Launchpad API. It holds the OAuth credential
+// and its token exchange with the Launchpad web site, the client sending signed requests and
+// the multipart bodies uploading files. The lp-api command and the typed client of lpclient
+// share it.
+package lpapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Credential is the OAuth access token of a Launchpad user, as stored in ~/.config/lp-api.toml
+type Credential struct {
+	Key    string `toml:"oauth_consumer_key"`
+	Token  string `toml:"oauth_token"`
+	Secret string `toml:"oauth_token_secret"`
+}
+
+// Authorization returns the value of the Authorization header signing a request with the credential
+func (c Credential) Authorization() string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("OAuth realm=\"https://api.launchpad.net/\", oauth_consumer_key=\"%s\", oauth_token=\"%s\", oauth_signature=\"&%s\", oauth_nonce=\"%d\", oauth_signature_method=\"PLAINTEXT\", oauth_timestamp=\"%d\", oauth_version=\"1.0\"", c.Key, c.Token, c.Secret, timestamp, timestamp)
+}
+
+// Sign adds the Authorization header of the credential to the request
+func (c Credential) Sign(req *http.Request) {
+	req.Header.Add("Authorization", c.Authorization())
+}
+
+// tokenForm posts the form to an OAuth endpoint of webRoot and returns the answer
+func tokenForm(client *http.Client, webRoot string, endpoint string, form url.Values) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.PostForm(webRoot+endpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// readToken sets the token and its secret from the answer of an OAuth endpoint
+func (c *Credential) readToken(mesg string) error {
+	m, err := url.ParseQuery(mesg)
+	if err != nil {
+		return err
+	}
+	if m.Get("oauth_token") == "" || m.Get("oauth_token_secret") == "" {
+		return errors.New("No OAuth token in the answer of Launchpad: " + mesg)
+	}
+	c.Token = m.Get("oauth_token")
+	c.Secret = m.Get("oauth_token_secret")
+	return nil
+}
+
+// RequestToken gets a request token for consumerKey from webRoot, the Launchpad web site such as
+// https://launchpad.net/. The user authorizes it at webRoot+authorize-token?oauth_token=Token.
+func (c *Credential) RequestToken(client *http.Client, webRoot string, consumerKey string) error {
+	mesg, err := tokenForm(client, webRoot, "+request-token", url.Values{
+		"oauth_consumer_key":     {consumerKey},
+		"oauth_signature_method": {"PLAINTEXT"},
+		"oauth_signature":        {"&"},
+	})
+	if err != nil {
+		return err
+	}
+	c.Key = consumerKey
+	return c.readToken(mesg)
+}
+
+// AccessToken exchanges the request token for an access token once the user has authorized it,
+// asking webRoot again every second until the user decides
+func (c *Credential) AccessToken(client *http.Client, webRoot string) error {
+	for {
+		time.Sleep(time.Second)
+		mesg, err := tokenForm(client, webRoot, "+access-token", url.Values{
+			"oauth_token":            {c.Token},
+			"oauth_consumer_key":     {c.Key},
+			"oauth_signature_method": {"PLAINTEXT"},
+			"oauth_signature":        {"&" + c.Secret},
+		})
+		if err != nil {
+			return err
+		}
+		switch mesg {
+		case "Request token has not yet been reviewed. Try again later.":
+			continue
+		case "End-user refused to authorize request token.":
+			return errors.New(mesg)
+		}
+		return c.readToken(mesg)
+	}
+}
@@ -0,0 +1,243 @@
+package lpapi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FileAttachment represents a file to be uploaded to Launchpad
+type FileAttachment struct {
+	// Field is the name of the multipart form field carrying the content
+	Field       string
+	Path        string
+	Filename    string
+	ContentType string
+	// Size is the number of bytes that will be uploaded, or -1 when it
+	// cannot be known in advance (e.g. when streaming from a pipe).
+	Size int64
+	// Data holds the content when it is already in memory. When nil, the
+	// content is streamed from Path at upload time, and a Path of "-" streams stdin.
+	Data []byte
+}
+
+// NewFileAttachment describes the file at filePath without reading it
+func NewFileAttachment(filePath string) (*FileAttachment, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", filePath)
+	}
+	size := fi.Size()
+	if !fi.Mode().IsRegular() {
+		size = -1
+	}
+	return &FileAttachment{
+		Path:        filePath,
+		Filename:    filepath.Base(filePath),
+		ContentType: DetectContentType(filePath),
+		Size:        size,
+	}, nil
+}
+
+// IsFilePart tells whether a key=@path argument of a POST is uploaded as a multipart file part
+// rather than sent as a text form value with the content of the file. wadlType is the type the WADL
+// gives to the parameter, such as binary or string, or "" when the WADL or the parameter is unknown.
+// Unless the WADL says the parameter is text, the file is uploaded as it is. A file that isn't valid
+// UTF-8 is uploaded too, since it would be corrupted as a form value. Stdin, whose path is "-", can
+// only be read once and follows the WADL.
+func IsFilePart(path string, wadlType string) bool {
+	if wadlType == "" || wadlType == "binary" {
+		return true
+	}
+	return path != "-" && !validUTF8(path)
+}
+
+// validUTF8 tells whether the file at path is text encoded in UTF-8, reading it up to the first invalid byte
+func validUTF8(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		c, size, err := r.ReadRune()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil || (c == utf8.RuneError && size == 1) {
+			return false
+		}
+	}
+}
+
+// Open returns a reader for the attachment content
+func (a FileAttachment) Open() (io.ReadCloser, error) {
+	if a.Data != nil {
+		return io.NopCloser(bytes.NewReader(a.Data)), nil
+	}
+	if a.Path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(a.Path)
+}
+
+// Length returns the upload size of the attachment, or -1 if unknown
+func (a FileAttachment) Length() int64 {
+	if a.Data != nil {
+		return int64(len(a.Data))
+	}
+	return a.Size
+}
+
+// DetectContentType detects MIME type from file extension and falls back to sniffing the file content
+func DetectContentType(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext != "" {
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			return contentType
+		}
+	}
+	return sniffContentType(filePath)
+}
+
+// sniffContentType detects MIME type from the first bytes of the file
+func sniffContentType(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if n == 0 || (err != nil && err != io.ErrUnexpectedEOF) {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(head[:n])
+}
+
+// countingWriter discards everything written to it and counts the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// quoteEscaper escapes the quoted strings of a Content-Disposition header the same way as mime/multipart
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// EscapeQuotes escapes s for a double quoted string of a Content-Disposition header, the same way as mime/multipart
+func EscapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// WriteMultipart writes the multipart/form-data layout to writer, copying each file content from the matching reader in srcs
+func WriteMultipart(writer *multipart.Writer, attachments []FileAttachment, srcs []io.Reader, params map[string]string) error {
+	// Add file data fields
+	for i, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, EscapeQuotes(attachment.Field), EscapeQuotes(attachment.Filename)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, srcs[i]); err != nil {
+			return err
+		}
+	}
+
+	// Add other form fields in a stable order
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writer.WriteField(key, params[key]); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// multipartLength computes the exact size of the multipart body so that the
+// request can be sent with a Content-Length instead of chunked encoding
+func multipartLength(boundary string, attachments []FileAttachment, params map[string]string) (int64, error) {
+	var size int64
+	empty := make([]io.Reader, len(attachments))
+	for i, attachment := range attachments {
+		if attachment.Length() < 0 {
+			return -1, nil
+		}
+		size += attachment.Length()
+		empty[i] = strings.NewReader("")
+	}
+	counter := &countingWriter{}
+	writer := multipart.NewWriter(counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return -1, err
+	}
+	if err := WriteMultipart(writer, attachments, empty, params); err != nil {
+		return -1, err
+	}
+	return counter.n + size, nil
+}
+
+// MultipartBody constructs a streaming multipart/form-data request body with file contents and form fields.
+// Each file is read from disk while the body is consumed, so it is never held in memory as a whole.
+// It returns the body, its content type and its length, which is -1 when the length is unknown.
+func MultipartBody(attachments []FileAttachment, params map[string]string) (io.ReadCloser, string, int64, error) {
+	srcs := make([]io.Reader, 0, len(attachments))
+	closers := make([]io.Closer, 0, len(attachments))
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+	for _, attachment := range attachments {
+		src, err := attachment.Open()
+		if err != nil {
+			closeAll()
+			return nil, "", -1, err
+		}
+		srcs = append(srcs, src)
+		closers = append(closers, src)
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	length, err := multipartLength(writer.Boundary(), attachments, params)
+	if err != nil {
+		closeAll()
+		return nil, "", -1, err
+	}
+
+	go func() {
+		defer closeAll()
+		pw.CloseWithError(WriteMultipart(writer, attachments, srcs, params))
+	}()
+
+	return pr, writer.FormDataContentType(), length, nil
+}
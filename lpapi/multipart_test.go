@@ -0,0 +1,268 @@
+package lpapi
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		filepath string
+		want     string
+	}{
+		{"text log", "file.log", "text/"},
+		{"text file", "file.txt", "text/plain"},
+		{"png image", "screenshot.png", "image/png"},
+		{"jpg image", "photo.jpg", "image/jpeg"},
+		{"json file", "config.json", "application/json"},
+		{"yaml file", "config.yaml", "application/"},
+		{"tar.gz archive", "backup.tar.gz", "application/gzip"},
+		{"unknown extension", "file.xyz", "application/octet-stream"},
+		{"uppercase extension", "FILE.LOG", "text/"},
+		{"no extension", "Makefile", "application/octet-stream"},
+		{"dot in directory only", "/tmp/dir.d/core", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectContentType(tt.filepath)
+			// Some MIME types may have charset suffix
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("DetectContentType(%q) = %q, want prefix %q", tt.filepath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectContentType_sniffing(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		want    string
+	}{
+		{"text without extension", "core", []byte("plain text content\n"), "text/plain"},
+		{"png without extension", "screenshot", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"gzip with unknown extension", "dump.xyz", []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), "application/x-gzip"},
+		{"empty file", "empty", []byte{}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(tmpDir, tt.file)
+			if err := os.WriteFile(file, tt.content, 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if got := DetectContentType(file); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("DetectContentType(%q) = %q, want prefix %q", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFilePart(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "comment.txt")
+	if err := os.WriteFile(text, []byte("Fixed in 1.2 – thanks"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "example.tar.gz")
+	if err := os.WriteFile(binary, []byte{0x1f, 0x8b, 0x08, 0x00, 0xff}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		wadlType string
+		want     bool
+	}{
+		{text, "", true},
+		{text, "binary", true},
+		{text, "string", false},
+		{binary, "string", true},
+		{binary, "", true},
+		{"-", "string", false},
+		{"-", "", true},
+	}
+	for _, tt := range tests {
+		if got := IsFilePart(tt.path, tt.wadlType); got != tt.want {
+			t.Errorf("IsFilePart(%q, %q) = %v, want %v", filepath.Base(tt.path), tt.wadlType, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeQuotes(t *testing.T) {
+	if got, want := EscapeQuotes(`my "crash" C:\log.txt`), `my \"crash\" C:\\log.txt`; got != want {
+		t.Errorf("EscapeQuotes() = %s, want %s", got, want)
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	attachment := FileAttachment{
+		Field:       "data",
+		Path:        "/tmp/test.log",
+		Filename:    "test.log",
+		ContentType: "text/plain",
+		Data:        []byte("test file content"),
+	}
+
+	params := map[string]string{
+		"ws.op":       "addAttachment",
+		"description": "Test description",
+	}
+
+	body, contentType, length, err := MultipartBody([]FileAttachment{attachment}, params)
+	if err != nil {
+		t.Fatalf("MultipartBody() error = %v", err)
+	}
+	defer body.Close()
+
+	// Verify content type header
+	if !strings.HasPrefix(contentType, "multipart/form-data; boundary=") {
+		t.Errorf("Content-Type = %q, want prefix 'multipart/form-data; boundary='", contentType)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading multipart body error = %v", err)
+	}
+
+	// Verify body is not empty
+	if len(data) == 0 {
+		t.Error("MultipartBody() returned empty body")
+	}
+
+	// Verify the announced length matches what is streamed
+	if int64(len(data)) != length {
+		t.Errorf("MultipartBody() length = %d, streamed %d bytes", length, len(data))
+	}
+}
+
+func TestMultipartBody_streamsFromDisk(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := tmpDir + "/crash.dump"
+	content := bytes.Repeat([]byte{0x00, 0x01, 0x02, 0xFF}, 64*1024)
+	if err := os.WriteFile(testFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	attachment, err := NewFileAttachment(testFile)
+	if err != nil {
+		t.Fatalf("NewFileAttachment() error = %v", err)
+	}
+	if attachment.Data != nil {
+		t.Error("NewFileAttachment() should not read the file into memory")
+	}
+	if attachment.Size != int64(len(content)) {
+		t.Errorf("NewFileAttachment() size = %d, want %d", attachment.Size, len(content))
+	}
+
+	attachment.Field = "data"
+	body, contentType, length, err := MultipartBody([]FileAttachment{*attachment}, map[string]string{"comment": "dump"})
+	if err != nil {
+		t.Fatalf("MultipartBody() error = %v", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading multipart body error = %v", err)
+	}
+	if int64(len(data)) != length {
+		t.Errorf("MultipartBody() length = %d, streamed %d bytes", length, len(data))
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType() error = %v", err)
+	}
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() error = %v", err)
+	}
+	if part.FormName() != "data" || part.FileName() != "crash.dump" {
+		t.Errorf("file part = %q/%q, want data/crash.dump", part.FormName(), part.FileName())
+	}
+	if got := part.Header.Get("Content-Type"); got != attachment.ContentType {
+		t.Errorf("file part Content-Type = %q, want %q", got, attachment.ContentType)
+	}
+	got, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatalf("reading file part error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("file part has %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestMultipartBody_multipleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"file_content":      tmpDir + "/release.tar.gz",
+		"signature_content": tmpDir + "/release.tar.gz.asc",
+	}
+	for field, file := range files {
+		if err := os.WriteFile(file, []byte("content of "+field), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var attachments []FileAttachment
+	for _, field := range []string{"file_content", "signature_content"} {
+		attachment, err := NewFileAttachment(files[field])
+		if err != nil {
+			t.Fatalf("NewFileAttachment() error = %v", err)
+		}
+		attachment.Field = field
+		attachments = append(attachments, *attachment)
+	}
+
+	body, contentType, length, err := MultipartBody(attachments, map[string]string{"ws.op": "add_file", "description": "Release tarball"})
+	if err != nil {
+		t.Fatalf("MultipartBody() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading multipart body error = %v", err)
+	}
+	if int64(len(data)) != length {
+		t.Errorf("MultipartBody() length = %d, streamed %d bytes", length, len(data))
+	}
+
+	_, mediaParams, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType() error = %v", err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(data), mediaParams["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("ReadForm() error = %v", err)
+	}
+	for field, file := range files {
+		headers := form.File[field]
+		if len(headers) != 1 {
+			t.Fatalf("form has %d %q file parts, want 1", len(headers), field)
+		}
+		if headers[0].Filename != filepath.Base(file) {
+			t.Errorf("%s filename = %q, want %q", field, headers[0].Filename, filepath.Base(file))
+		}
+	}
+	if got := form.Value["ws.op"]; len(got) != 1 || got[0] != "add_file" {
+		t.Errorf("ws.op = %v, want [add_file]", got)
+	}
+}
+
+func TestNewFileAttachment_notFound(t *testing.T) {
+	_, err := NewFileAttachment(t.TempDir() + "/nonexistent.log")
+	if !os.IsNotExist(err) {
+		t.Errorf("NewFileAttachment() error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,231 @@
+// Package lpclient is a typed client for the Launchpad API. The entry types and their
+// named operations in zz_generated.go are generated from the WADL description of the
+// devel service root by lp-api, and the requests are sent through a Transport such as
+// the lpapi.Client shared with lp-api, which signs them with an OAuth credential.
+package lpclient
+
+//go:generate go run .. __generate-client -fetch https://api.launchpad.net/devel/ -wadl launchpad-devel.wadl -o zz_generated.go
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fourdollars/lp-api/lpapi"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport sends the requests of the client. Arguments use the syntax of the lp-api
+// command line: key==value for GET query parameters and key:=json or key=@file for POST.
+// For a 201 Created response, Post returns the link of the created entry.
+type Transport interface {
+	Get(resource string, args []string) (string, error)
+	Post(resource string, args []string) (string, error)
+}
+
+// Client gives typed access to the entries of a Launchpad service root
+type Client struct {
+	Transport Transport
+	// ServiceRoot is the base of relative links, such as https://api.launchpad.net/devel/
+	ServiceRoot string
+}
+
+// New returns a client for the service root that sends its requests through transport
+func New(transport Transport, serviceRoot string) *Client {
+	return &Client{Transport: transport, ServiceRoot: serviceRoot}
+}
+
+// NewWithCredential returns a client for the service root that signs its requests with the
+// credential, such as the one lp-api keeps in ~/.config/lp-api.toml
+func NewWithCredential(credential lpapi.Credential, serviceRoot string) *Client {
+	return New(&lpapi.Client{Credential: credential}, serviceRoot)
+}
+
+// Page is one page of a collection, as returned by named operations such as searchTasks
+type Page[T any] struct {
+	Entries            []T    `json:"entries"`
+	TotalSize          int    `json:"total_size"`
+	Start              int    `json:"start"`
+	NextCollectionLink string `json:"next_collection_link"`
+	PrevCollectionLink string `json:"prev_collection_link"`
+
+	next func(link string) (*Page[T], error)
+}
+
+// Next returns the following page, or nil at the end of the collection
+func (p *Page[T]) Next() (*Page[T], error) {
+	if p.NextCollectionLink == "" || p.next == nil {
+		return nil, nil
+	}
+	return p.next(p.NextCollectionLink)
+}
+
+// entryBase is embedded in the generated entry types. It keeps the client that fetched
+// the entry and its JSON representation.
+type entryBase struct {
+	client *Client
+	raw    json.RawMessage
+}
+
+func (e *entryBase) base() *entryBase { return e }
+
+// Field decodes the named field of the representation into v. It reads the fields
+// whose type the WADL doesn't tell, such as the list of tags of a bug.
+func (e *entryBase) Field(name string, v interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(e.raw, &fields); err != nil {
+		return err
+	}
+	value, ok := fields[name]
+	if !ok {
+		return fmt.Errorf("lpclient: there is no '%s' field", name)
+	}
+	return json.Unmarshal(value, v)
+}
+
+// entry is implemented by pointers to the generated entry types
+type entry interface {
+	base() *entryBase
+}
+
+// errNoClient is returned by the methods of entries that were not fetched through a client
+var errNoClient = errors.New("lpclient: the entry was not fetched through a Client")
+
+// link makes a link absolute
+func (c *Client) link(link string) string {
+	if strings.HasPrefix(link, "https://") || strings.HasPrefix(link, "http://") {
+		return link
+	}
+	return c.ServiceRoot + strings.TrimPrefix(link, "/")
+}
+
+// decodeEntry decodes the representation of an entry. Fields whose JSON type differs from
+// the one in the WADL, such as lists described as strings, are left empty instead of failing.
+func decodeEntry[T any, PT interface {
+	*T
+	entry
+}](c *Client, data []byte) (*T, error) {
+	var e T
+	if err := json.Unmarshal(data, &e); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+	}
+	b := PT(&e).base()
+	b.client = c
+	b.raw = append(json.RawMessage(nil), data...)
+	return &e, nil
+}
+
+// getEntry fetches the entry at link, or the one returned by a named operation
+func getEntry[T any, PT interface {
+	*T
+	entry
+}](c *Client, link string, args []string) (*T, error) {
+	payload, err := c.get(link, args)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntry[T, PT](c, []byte(payload))
+}
+
+// getPage fetches a page of a collection, or the one returned by a named operation
+func getPage[T any, PT interface {
+	*T
+	entry
+}](c *Client, link string, args []string) (*Page[T], error) {
+	payload, err := c.get(link, args)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Page[T]
+		Entries []json.RawMessage `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return nil, err
+	}
+	page := raw.Page
+	page.Entries = make([]T, 0, len(raw.Entries))
+	for _, data := range raw.Entries {
+		e, err := decodeEntry[T, PT](c, data)
+		if err != nil {
+			return nil, err
+		}
+		page.Entries = append(page.Entries, *e)
+	}
+	page.next = func(link string) (*Page[T], error) {
+		return getPage[T, PT](c, link, nil)
+	}
+	return &page, nil
+}
+
+// get sends a named operation whose result has no generated type and returns the response body
+func (c *Client) get(link string, args []string) (string, error) {
+	if c == nil {
+		return "", errNoClient
+	}
+	return c.Transport.Get(c.link(link), args)
+}
+
+// post sends a named operation and returns the response body
+func (c *Client) post(link string, args []string) (string, error) {
+	if c == nil {
+		return "", errNoClient
+	}
+	return c.Transport.Post(c.link(link), args)
+}
+
+// postEntry sends a named operation that returns an entry
+func postEntry[T any, PT interface {
+	*T
+	entry
+}](c *Client, link string, args []string) (*T, error) {
+	payload, err := c.post(link, args)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntry[T, PT](c, []byte(payload))
+}
+
+// queryArg encodes a GET parameter. A leading @ is escaped so that it is not read as a file name.
+func queryArg(key string, value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+		if strings.HasPrefix(text, "@") || strings.HasPrefix(text, "\\@") {
+			text = "\\" + text
+		}
+	case time.Time:
+		text = v.Format(time.RFC3339)
+	case int:
+		text = strconv.Itoa(v)
+	case bool:
+		text = strconv.FormatBool(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		text = fmt.Sprint(v)
+	}
+	return key + "==" + text
+}
+
+// formArg encodes a POST parameter as typed JSON, which is never read as a file name
+func formArg(key string, value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		value = t.Format(time.RFC3339)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(strconv.Quote(fmt.Sprint(value)))
+	}
+	return key + ":=" + string(data)
+}
+
+// fileArg encodes a POST parameter whose value is uploaded from the file at path
+func fileArg(key string, path string) string {
+	return key + "=@" + path
+}
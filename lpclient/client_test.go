@@ -0,0 +1,159 @@
+package lpclient
+
+import (
+	"errors"
+	"github.com/fourdollars/lp-api/launchpadtest"
+	"github.com/fourdollars/lp-api/lpapi"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeTransport answers with canned payloads and records the requests
+type fakeTransport struct {
+	payloads map[string]string
+	requests []string
+	args     [][]string
+}
+
+func (f *fakeTransport) do(method string, resource string, args []string) (string, error) {
+	f.requests = append(f.requests, method+" "+resource)
+	f.args = append(f.args, args)
+	payload, ok := f.payloads[method+" "+resource]
+	if !ok {
+		return "", errors.New("unexpected request " + method + " " + resource)
+	}
+	return payload, nil
+}
+
+func (f *fakeTransport) Get(resource string, args []string) (string, error) {
+	return f.do("GET", resource, args)
+}
+
+func (f *fakeTransport) Post(resource string, args []string) (string, error) {
+	return f.do("POST", resource, args)
+}
+
+const root = "https://api.launchpad.net/devel/"
+
+func TestClient_entries(t *testing.T) {
+	transport := &fakeTransport{payloads: map[string]string{
+		"GET " + root + "bugs/1": `{
+			"self_link": "https://api.launchpad.net/devel/bugs/1",
+			"id": 1,
+			"title": "Microsoft has a majority market share",
+			"private": false,
+			"date_created": "2004-08-20T00:00:00+00:00",
+			"owner_link": "https://api.launchpad.net/devel/~sabdfl",
+			"tags": ["lunch", "world-domination"]
+		}`,
+		"GET " + root + "~sabdfl": `{"self_link": "https://api.launchpad.net/devel/~sabdfl", "name": "sabdfl", "karma": 42}`,
+	}}
+	c := New(transport, root)
+
+	bug, err := c.Bug("bugs/1")
+	if err != nil {
+		t.Fatalf("Bug() error = %v", err)
+	}
+	if bug.ID != 1 || bug.Title != "Microsoft has a majority market share" || bug.DateCreated.Year() != 2004 {
+		t.Errorf("Bug() = %+v", bug)
+	}
+	// The tags are a list although the WADL doesn't tell it
+	var tags []string
+	if err := bug.Field("tags", &tags); err != nil || !reflect.DeepEqual(tags, []string{"lunch", "world-domination"}) {
+		t.Errorf("Field(tags) = %v, %v", tags, err)
+	}
+
+	owner, err := bug.Owner()
+	if err != nil {
+		t.Fatalf("Owner() error = %v", err)
+	}
+	if owner.Name != "sabdfl" || owner.Karma != 42 {
+		t.Errorf("Owner() = %+v", owner)
+	}
+
+	var unfetched Bug
+	if _, err := unfetched.Owner(); err != errNoClient {
+		t.Errorf("Owner() of an entry not fetched through a client error = %v", err)
+	}
+}
+
+func TestClient_namedOperations(t *testing.T) {
+	transport := &fakeTransport{payloads: map[string]string{
+		"GET " + root + "ubuntu": `{"self_link": "https://api.launchpad.net/devel/ubuntu", "name": "ubuntu"}`,
+		"GET " + root + "ubuntu?page=1": `{
+			"total_size": 3, "start": 0,
+			"next_collection_link": "https://api.launchpad.net/devel/ubuntu?page=2",
+			"entries": [{"status": "New", "importance": "High"}, {"status": "Triaged"}]
+		}`,
+		"GET " + root + "ubuntu?page=2": `{"total_size": 3, "start": 2, "entries": [{"status": "Fix Released"}]}`,
+		"POST " + root + "bugs/1":       ``,
+	}}
+	c := New(transport, root)
+
+	ubuntu, err := c.Distribution("ubuntu")
+	if err != nil {
+		t.Fatalf("Distribution() error = %v", err)
+	}
+	// Pretend the search answers with the first page
+	ubuntu.SelfLink += "?page=1"
+	since := time.Date(2024, 4, 25, 0, 0, 0, 0, time.UTC)
+	page, err := ubuntu.SearchTasks(DistributionSearchTasksParams{Status: "New", SearchText: "@crash", ModifiedSince: since})
+	if err != nil {
+		t.Fatalf("SearchTasks() error = %v", err)
+	}
+	wantArgs := []string{"ws.op==searchTasks", "modified_since==2024-04-25T00:00:00Z", `search_text==\@crash`, "status==New"}
+	if got := transport.args[len(transport.args)-1]; !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("SearchTasks() args = %q, want %q", got, wantArgs)
+	}
+	if page.TotalSize != 3 || len(page.Entries) != 2 || page.Entries[0].Importance != "High" {
+		t.Errorf("SearchTasks() = %+v", page)
+	}
+	next, err := page.Next()
+	if err != nil || next == nil || len(next.Entries) != 1 || next.Entries[0].Status != "Fix Released" {
+		t.Fatalf("Next() = %+v, %v", next, err)
+	}
+	if last, err := next.Next(); last != nil || err != nil {
+		t.Errorf("Next() at the end = %+v, %v", last, err)
+	}
+
+	bug := Bug{SelfLink: root + "bugs/1"}
+	bug.client = c
+	if _, err := bug.NewMessage(BugNewMessageParams{Content: "@alice thanks"}); err != nil {
+		t.Fatalf("NewMessage() error = %v", err)
+	}
+	wantArgs = []string{"ws.op=newMessage", `content:="@alice thanks"`}
+	if got := transport.args[len(transport.args)-1]; !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("NewMessage() args = %q, want %q", got, wantArgs)
+	}
+
+	if _, err := bug.AddAttachment(BugAddAttachmentParams{Comment: "Log", Data: "/tmp/crash.log", Filename: "crash.log", IsPatch: true}); err != nil {
+		t.Fatalf("AddAttachment() error = %v", err)
+	}
+	wantArgs = []string{"ws.op=addAttachment", `comment:="Log"`, "data=@/tmp/crash.log", `filename:="crash.log"`, "is_patch:=true"}
+	if got := transport.args[len(transport.args)-1]; !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("AddAttachment() args = %q, want %q", got, wantArgs)
+	}
+}
+
+func TestNewWithCredential(t *testing.T) {
+	s := launchpadtest.NewServer()
+	defer s.Close()
+	c := NewWithCredential(lpapi.Credential{Key: "lp-api", Token: "token", Secret: "secret"}, s.ServiceRoot())
+
+	bug, err := c.Bug("bugs/1")
+	if err != nil {
+		t.Fatalf("Bug() error = %v", err)
+	}
+	owner, err := bug.Owner()
+	if err != nil || owner.Name == "" {
+		t.Fatalf("Owner() = %+v, %v", owner, err)
+	}
+	location, err := bug.NewMessage(BugNewMessageParams{Content: "@alice thanks"})
+	if err != nil {
+		t.Fatalf("NewMessage() error = %v", err)
+	}
+	if b, _ := s.Launchpad.Bug(1); location != s.ServiceRoot()+"bugs/1/messages/1" || b.Messages[1].Content != "@alice thanks" {
+		t.Errorf("NewMessage() = %s, messages = %+v", location, b.Messages)
+	}
+}
@@ -0,0 +1,589 @@
+// Code generated by lp-api __generate-client from the WADL of https://api.launchpad.net/devel/. DO NOT EDIT.
+
+package lpclient
+
+import "time"
+
+// Archive is an entry of the archive resource type.
+//
+// Main Archive interface.
+type Archive struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Description
+	Description string `json:"description"`
+	// Display name
+	Displayname string `json:"displayname"`
+	// Name
+	Name string `json:"name"`
+	// Owner
+	OwnerLink string `json:"owner_link"`
+	// Private
+	Private bool `json:"private"`
+	// Reference
+	Reference string `json:"reference"`
+}
+
+// Archive fetches the archive at link.
+func (c *Client) Archive(link string) (*Archive, error) {
+	return getEntry[Archive](c, link, nil)
+}
+
+// Owner fetches the entry at owner_link.
+func (x *Archive) Owner() (*Person, error) {
+	return getEntry[Person](x.client, x.OwnerLink, nil)
+}
+
+// ArchiveGetBuildRecordsParams holds the parameters of Archive.GetBuildRecords. Optional parameters are left out when they hold their zero value.
+type ArchiveGetBuildRecordsParams struct {
+	// Build status
+	// One of: Needs building, Successfully built, Failed to build, Dependency wait, Chroot problem, Build for superseded Source, Currently building, Failed to upload, Uploading build, Cancelling build, Cancelled build.
+	BuildState string
+	// Source package name
+	SourceName string
+}
+
+// GetBuildRecords sends the getBuildRecords named operation with GET.
+//
+// Return build records in the context it is implemented.
+func (x *Archive) GetBuildRecords(p ArchiveGetBuildRecordsParams) (*Page[Build], error) {
+	args := []string{"ws.op==getBuildRecords"}
+	if p.BuildState != "" {
+		args = append(args, queryArg("build_state", p.BuildState))
+	}
+	if p.SourceName != "" {
+		args = append(args, queryArg("source_name", p.SourceName))
+	}
+	return getPage[Build](x.client, x.SelfLink, args)
+}
+
+// ArchiveGetPublishedSourcesParams holds the parameters of Archive.GetPublishedSources. Optional parameters are left out when they hold their zero value.
+type ArchiveGetPublishedSourcesParams struct {
+	// Return entries whose `date_created` is greater than or equal to this date.
+	CreatedSinceDate time.Time
+	// Whether or not to filter source names by exact matching.
+	ExactMatch bool
+	// Source package name
+	SourceName string
+	// Package Publishing Status
+	// One of: Pending, Published, Superseded, Deleted, Obsolete.
+	Status string
+}
+
+// GetPublishedSources sends the getPublishedSources named operation with GET.
+//
+// All ISourcePackagePublishingHistory target to this archive.
+func (x *Archive) GetPublishedSources(p ArchiveGetPublishedSourcesParams) (*Page[SourcePackagePublishingHistory], error) {
+	args := []string{"ws.op==getPublishedSources"}
+	if !p.CreatedSinceDate.IsZero() {
+		args = append(args, queryArg("created_since_date", p.CreatedSinceDate))
+	}
+	if p.ExactMatch {
+		args = append(args, queryArg("exact_match", p.ExactMatch))
+	}
+	if p.SourceName != "" {
+		args = append(args, queryArg("source_name", p.SourceName))
+	}
+	if p.Status != "" {
+		args = append(args, queryArg("status", p.Status))
+	}
+	return getPage[SourcePackagePublishingHistory](x.client, x.SelfLink, args)
+}
+
+// Archives is the top-level archives collection.
+type Archives struct {
+	client *Client
+}
+
+// Archives returns the top-level archives collection.
+func (c *Client) Archives() *Archives {
+	return &Archives{client: c}
+}
+
+// ArchivesGetByReferenceParams holds the parameters of Archives.GetByReference. Optional parameters are left out when they hold their zero value.
+type ArchivesGetByReferenceParams struct {
+	// Archive reference string
+	// Required.
+	Reference string
+}
+
+// GetByReference sends the getByReference named operation with GET.
+//
+// Return the archive with the given reference, if any.
+func (x *Archives) GetByReference(p ArchivesGetByReferenceParams) (*Archive, error) {
+	args := []string{"ws.op==getByReference"}
+	args = append(args, queryArg("reference", p.Reference))
+	return getEntry[Archive](x.client, "archives", args)
+}
+
+// Bug is an entry of the bug resource type.
+//
+// A bug.
+type Bug struct {
+	entryBase
+
+	SelfLink               string `json:"self_link"`
+	WebLink                string `json:"web_link"`
+	ResourceTypeLink       string `json:"resource_type_link"`
+	HTTPEtag               string `json:"http_etag"`
+	ActivityCollectionLink string `json:"activity_collection_link"`
+	BugTasksCollectionLink string `json:"bug_tasks_collection_link"`
+	// Date Created
+	DateCreated time.Time `json:"date_created"`
+	// Description
+	Description string `json:"description"`
+	// Duplicate Of
+	DuplicateOfLink string `json:"duplicate_of_link"`
+	// Bug ID
+	ID int `json:"id"`
+	// Information Type
+	InformationType        string `json:"information_type"`
+	MessagesCollectionLink string `json:"messages_collection_link"`
+	OwnerLink              string `json:"owner_link"`
+	// This bug report should be private
+	Private bool `json:"private"`
+	// Tags
+	Tags string `json:"tags"`
+	// Summary
+	Title string `json:"title"`
+}
+
+// Bug fetches the bug at link.
+func (c *Client) Bug(link string) (*Bug, error) {
+	return getEntry[Bug](c, link, nil)
+}
+
+// BugTasks fetches the first page of bug_tasks_collection_link.
+func (x *Bug) BugTasks() (*Page[BugTask], error) {
+	return getPage[BugTask](x.client, x.BugTasksCollectionLink, nil)
+}
+
+// DuplicateOf fetches the entry at duplicate_of_link.
+func (x *Bug) DuplicateOf() (*Bug, error) {
+	return getEntry[Bug](x.client, x.DuplicateOfLink, nil)
+}
+
+// Owner fetches the entry at owner_link.
+func (x *Bug) Owner() (*Person, error) {
+	return getEntry[Person](x.client, x.OwnerLink, nil)
+}
+
+// BugAddAttachmentParams holds the parameters of Bug.AddAttachment. Optional parameters are left out when they hold their zero value.
+type BugAddAttachmentParams struct {
+	// A comment which will be added to the bug.
+	// Required.
+	Comment string
+	// The MIME type of this attachment.
+	ContentType string
+	// The content of this attachment.
+	// Required.
+	// The path of the file to upload.
+	Data string
+	// A short description of this attachment.
+	Description string
+	// The original filename of this attachment.
+	// Required.
+	Filename string
+	// Is this attachment a patch?
+	IsPatch bool
+}
+
+// AddAttachment sends the addAttachment named operation with POST.
+//
+// Add an attachment to this bug.
+//
+// It returns the link of the new bug_attachment.
+func (x *Bug) AddAttachment(p BugAddAttachmentParams) (string, error) {
+	args := []string{"ws.op=addAttachment"}
+	args = append(args, formArg("comment", p.Comment))
+	if p.ContentType != "" {
+		args = append(args, formArg("content_type", p.ContentType))
+	}
+	args = append(args, fileArg("data", p.Data))
+	if p.Description != "" {
+		args = append(args, formArg("description", p.Description))
+	}
+	args = append(args, formArg("filename", p.Filename))
+	if p.IsPatch {
+		args = append(args, formArg("is_patch", p.IsPatch))
+	}
+	return x.client.post(x.SelfLink, args)
+}
+
+// BugIsUserAffectedParams holds the parameters of Bug.IsUserAffected. Optional parameters are left out when they hold their zero value.
+type BugIsUserAffectedParams struct {
+	User string
+}
+
+// IsUserAffected sends the isUserAffected named operation with GET.
+//
+// Is the user affected by this bug?
+//
+// It returns the body of the response.
+func (x *Bug) IsUserAffected(p BugIsUserAffectedParams) (string, error) {
+	args := []string{"ws.op==isUserAffected"}
+	if p.User != "" {
+		args = append(args, queryArg("user", p.User))
+	}
+	return x.client.get(x.SelfLink, args)
+}
+
+// BugMarkAsDuplicateParams holds the parameters of Bug.MarkAsDuplicate. Optional parameters are left out when they hold their zero value.
+type BugMarkAsDuplicateParams struct {
+	// Required.
+	DuplicateOf string
+}
+
+// MarkAsDuplicate sends the markAsDuplicate named operation with POST.
+//
+// Mark this bug report as a duplicate of another bug.
+//
+// It returns the body of the response.
+func (x *Bug) MarkAsDuplicate(p BugMarkAsDuplicateParams) (string, error) {
+	args := []string{"ws.op=markAsDuplicate"}
+	args = append(args, formArg("duplicate_of", p.DuplicateOf))
+	return x.client.post(x.SelfLink, args)
+}
+
+// BugNewMessageParams holds the parameters of Bug.NewMessage. Optional parameters are left out when they hold their zero value.
+type BugNewMessageParams struct {
+	// Message
+	// Required.
+	Content string
+	// Subject
+	Subject string
+}
+
+// NewMessage sends the newMessage named operation with POST.
+//
+// Create a new message, and link it to this object.
+//
+// It returns the link of the new message.
+func (x *Bug) NewMessage(p BugNewMessageParams) (string, error) {
+	args := []string{"ws.op=newMessage"}
+	args = append(args, formArg("content", p.Content))
+	if p.Subject != "" {
+		args = append(args, formArg("subject", p.Subject))
+	}
+	return x.client.post(x.SelfLink, args)
+}
+
+// BugTask is an entry of the bug_task resource type.
+//
+// A bug needing fixing in a particular product or package.
+type BugTask struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Assigned to
+	AssigneeLink string `json:"assignee_link"`
+	BugLink      string `json:"bug_link"`
+	// Importance
+	Importance string `json:"importance"`
+	// Status
+	Status string `json:"status"`
+}
+
+// BugTask fetches the bug_task at link.
+func (c *Client) BugTask(link string) (*BugTask, error) {
+	return getEntry[BugTask](c, link, nil)
+}
+
+// Assignee fetches the entry at assignee_link.
+func (x *BugTask) Assignee() (*Person, error) {
+	return getEntry[Person](x.client, x.AssigneeLink, nil)
+}
+
+// Bug fetches the entry at bug_link.
+func (x *BugTask) Bug() (*Bug, error) {
+	return getEntry[Bug](x.client, x.BugLink, nil)
+}
+
+// Bugs is the top-level bugs collection.
+//
+// The set of bugs.
+type Bugs struct {
+	client *Client
+}
+
+// Bugs returns the top-level bugs collection.
+func (c *Client) Bugs() *Bugs {
+	return &Bugs{client: c}
+}
+
+// BugsCreateBugParams holds the parameters of Bugs.CreateBug. Optional parameters are left out when they hold their zero value.
+type BugsCreateBugParams struct {
+	// A detailed description of the problem you are seeing.
+	// Required.
+	Description string
+	// The type of information contained in this bug report.
+	// One of: Public, Public Security, Private Security, Private, Proprietary, Embargoed.
+	InformationType string
+	// Space-separated keywords for classifying this bug report. May contain only lowercase letters, numbers, and hyphens.
+	Tags string
+	// The project, distribution or source package that has this bug.
+	// Required.
+	Target string
+	// Summary
+	// Required.
+	Title string
+}
+
+// CreateBug sends the createBug named operation with POST.
+//
+// Create a bug (with an appropriate bugtask) and return it.
+//
+// It returns the link of the new bug.
+func (x *Bugs) CreateBug(p BugsCreateBugParams) (string, error) {
+	args := []string{"ws.op=createBug"}
+	args = append(args, formArg("description", p.Description))
+	if p.InformationType != "" {
+		args = append(args, formArg("information_type", p.InformationType))
+	}
+	if p.Tags != "" {
+		args = append(args, formArg("tags", p.Tags))
+	}
+	args = append(args, formArg("target", p.Target))
+	args = append(args, formArg("title", p.Title))
+	return x.client.post("bugs", args)
+}
+
+// Build is an entry of the build resource type.
+//
+// A Build interface
+type Build struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Architecture tag
+	ArchTag string `json:"arch_tag"`
+	// Archive
+	ArchiveLink string `json:"archive_link"`
+	// Build Log URL
+	BuildLogURL string `json:"build_log_url"`
+	// Status
+	Buildstate string `json:"buildstate"`
+	// Can be retried
+	CanBeRetried bool `json:"can_be_retried"`
+	// Date finished
+	Datebuilt time.Time `json:"datebuilt"`
+	// Score of the related job (if any)
+	Score int `json:"score"`
+	// Title
+	Title string `json:"title"`
+}
+
+// Build fetches the build at link.
+func (c *Client) Build(link string) (*Build, error) {
+	return getEntry[Build](c, link, nil)
+}
+
+// Archive fetches the entry at archive_link.
+func (x *Build) Archive() (*Archive, error) {
+	return getEntry[Archive](x.client, x.ArchiveLink, nil)
+}
+
+// BuildRescoreParams holds the parameters of Build.Rescore. Optional parameters are left out when they hold their zero value.
+type BuildRescoreParams struct {
+	// Score
+	// Required.
+	Score int
+}
+
+// Rescore sends the rescore named operation with POST.
+//
+// Change the build's score.
+//
+// It returns the body of the response.
+func (x *Build) Rescore(p BuildRescoreParams) (string, error) {
+	args := []string{"ws.op=rescore"}
+	args = append(args, formArg("score", p.Score))
+	return x.client.post(x.SelfLink, args)
+}
+
+// Retry sends the retry named operation with POST.
+//
+// Restore the build record to its initial state.
+//
+// It returns the body of the response.
+func (x *Build) Retry() (string, error) {
+	args := []string{"ws.op=retry"}
+	return x.client.post(x.SelfLink, args)
+}
+
+// Distribution is an entry of the distribution resource type.
+//
+// An operating system distribution.
+type Distribution struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Display Name
+	DisplayName string `json:"display_name"`
+	// Name
+	Name                 string `json:"name"`
+	OwnerLink            string `json:"owner_link"`
+	SeriesCollectionLink string `json:"series_collection_link"`
+}
+
+// Distribution fetches the distribution at link.
+func (c *Client) Distribution(link string) (*Distribution, error) {
+	return getEntry[Distribution](c, link, nil)
+}
+
+// Owner fetches the entry at owner_link.
+func (x *Distribution) Owner() (*Person, error) {
+	return getEntry[Person](x.client, x.OwnerLink, nil)
+}
+
+// DistributionSearchTasksParams holds the parameters of Distribution.SearchTasks. Optional parameters are left out when they hold their zero value.
+type DistributionSearchTasksParams struct {
+	// Assignee
+	Assignee string
+	// Importance
+	// One of: Unknown, Undecided, Critical, High, Medium, Low, Wishlist.
+	Importance    string
+	ModifiedSince time.Time
+	// Bug ID or search text.
+	SearchText string
+	// Status
+	// One of: New, Incomplete, Opinion, Invalid, Won't Fix, Expired, Confirmed, Triaged, In Progress, Deferred, Fix Committed, Fix Released, Does Not Exist, Unknown.
+	Status string
+	// Tags
+	Tags string
+	// One of: Any, All.
+	TagsCombinator string
+}
+
+// SearchTasks sends the searchTasks named operation with GET.
+//
+// Search the IBugTasks reported on this entity.
+func (x *Distribution) SearchTasks(p DistributionSearchTasksParams) (*Page[BugTask], error) {
+	args := []string{"ws.op==searchTasks"}
+	if p.Assignee != "" {
+		args = append(args, queryArg("assignee", p.Assignee))
+	}
+	if p.Importance != "" {
+		args = append(args, queryArg("importance", p.Importance))
+	}
+	if !p.ModifiedSince.IsZero() {
+		args = append(args, queryArg("modified_since", p.ModifiedSince))
+	}
+	if p.SearchText != "" {
+		args = append(args, queryArg("search_text", p.SearchText))
+	}
+	if p.Status != "" {
+		args = append(args, queryArg("status", p.Status))
+	}
+	if p.Tags != "" {
+		args = append(args, queryArg("tags", p.Tags))
+	}
+	if p.TagsCombinator != "" {
+		args = append(args, queryArg("tags_combinator", p.TagsCombinator))
+	}
+	return getPage[BugTask](x.client, x.SelfLink, args)
+}
+
+// People is the top-level people collection.
+type People struct {
+	client *Client
+}
+
+// People returns the top-level people collection.
+func (c *Client) People() *People {
+	return &People{client: c}
+}
+
+// PeopleGetByEmailParams holds the parameters of People.GetByEmail. Optional parameters are left out when they hold their zero value.
+type PeopleGetByEmailParams struct {
+	// Required.
+	Email string
+}
+
+// GetByEmail sends the getByEmail named operation with GET.
+//
+// Return the person with the given email address.
+func (x *People) GetByEmail(p PeopleGetByEmailParams) (*Person, error) {
+	args := []string{"ws.op==getByEmail"}
+	args = append(args, queryArg("email", p.Email))
+	return getEntry[Person](x.client, "people", args)
+}
+
+// Person is an entry of the person resource type.
+//
+// A Person.
+type Person struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Display Name
+	DisplayName string `json:"display_name"`
+	// Name
+	Name string `json:"name"`
+	// Karma
+	Karma int `json:"karma"`
+}
+
+// Person fetches the person at link.
+func (c *Client) Person(link string) (*Person, error) {
+	return getEntry[Person](c, link, nil)
+}
+
+// PersonSearchTasksParams holds the parameters of Person.SearchTasks. Optional parameters are left out when they hold their zero value.
+type PersonSearchTasksParams struct {
+	BugReporter string
+	// One of: New, Triaged, Fix Released.
+	Status string
+}
+
+// SearchTasks sends the searchTasks named operation with GET.
+//
+// Search the IBugTasks reported on this entity.
+func (x *Person) SearchTasks(p PersonSearchTasksParams) (*Page[BugTask], error) {
+	args := []string{"ws.op==searchTasks"}
+	if p.BugReporter != "" {
+		args = append(args, queryArg("bug_reporter", p.BugReporter))
+	}
+	if p.Status != "" {
+		args = append(args, queryArg("status", p.Status))
+	}
+	return getPage[BugTask](x.client, x.SelfLink, args)
+}
+
+// SourcePackagePublishingHistory is an entry of the source_package_publishing_history resource type.
+//
+// A source package publishing history record.
+type SourcePackagePublishingHistory struct {
+	entryBase
+
+	SelfLink string `json:"self_link"`
+	// Archive
+	ArchiveLink string `json:"archive_link"`
+	// Date Published
+	DatePublished time.Time `json:"date_published"`
+	// Source Package Name
+	SourcePackageName string `json:"source_package_name"`
+	// Source Package Version
+	SourcePackageVersion string `json:"source_package_version"`
+	// Package Publishing Status
+	Status string `json:"status"`
+}
+
+// SourcePackagePublishingHistory fetches the source_package_publishing_history at link.
+func (c *Client) SourcePackagePublishingHistory(link string) (*SourcePackagePublishingHistory, error) {
+	return getEntry[SourcePackagePublishingHistory](c, link, nil)
+}
+
+// Archive fetches the entry at archive_link.
+func (x *SourcePackagePublishingHistory) Archive() (*Archive, error) {
+	return getEntry[Archive](x.client, x.ArchiveLink, nil)
+}
+
+// GetBuilds sends the getBuilds named operation with GET.
+//
+// Return a list of builds for this source publication.
+func (x *SourcePackagePublishingHistory) GetBuilds() (*Page[Build], error) {
+	args := []string{"ws.op==getBuilds"}
+	return getPage[Build](x.client, x.SelfLink, args)
+}
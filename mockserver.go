@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/fourdollars/lp-api/launchpadtest"
+)
+
+// mockServerCommand serves a fake Launchpad with sample data until lp-api is interrupted
+func mockServerCommand(args []string) error {
+	flags := flag.NewFlagSet("mock-server", flag.ContinueOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "The address to listen on, such as 127.0.0.1:0 for any free port.")
+	wadlPath := flags.String("wadl", "", "A WADL file to serve as the description of the service root, for describe, call and the validation of named operations.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	l := launchpadtest.New()
+	if *wadlPath != "" {
+		data, err := os.ReadFile(*wadlPath)
+		if err != nil {
+			return err
+		}
+		l.WADL = data
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	root := fmt.Sprintf("http://%s/devel/", listener.Addr())
+	fmt.Printf("Serving a fake Launchpad at %s\nUse it with `lp-api -service-root %s get bugs/1`, any OAuth token is accepted.\n", root, root)
+	return http.Serve(listener, l)
+}
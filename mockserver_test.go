@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fourdollars/lp-api/launchpadtest"
+)
+
+// useMockServer points lp-api at a fake Launchpad for the duration of the test
+func useMockServer(t *testing.T) *launchpadtest.Server {
+	s := launchpadtest.NewServer()
+	backupRoot, backupServiceRoot, backupMe := lpAPI, *serviceRoot, meLink
+	lpAPI, *serviceRoot, meLink = s.ServiceRoot(), s.ServiceRoot(), ""
+	t.Cleanup(func() {
+		s.Close()
+		lpAPI, *serviceRoot, meLink = backupRoot, backupServiceRoot, backupMe
+	})
+	return s
+}
+
+func TestMockServer(t *testing.T) {
+	s := useMockServer(t)
+
+	var c Credential
+	if err := c.RequestToken(nil, webRoot(), "lp-api test"); err != nil {
+		t.Fatalf("RequestToken() error = %v", err)
+	}
+	if err := c.AccessToken(nil, webRoot()); err != nil {
+		t.Fatalf("AccessToken() error = %v", err)
+	}
+	lp := LaunchpadAPI{Credential: c}
+
+	backupFollow := *follow
+	*follow = true
+	t.Cleanup(func() { *follow = backupFollow })
+	payload, err := lp.Post(lpAPI+"bugs/1", []string{"ws.op=newMessage", "content=Thanks"})
+	if err != nil {
+		t.Fatalf("Post(newMessage) error = %v", err)
+	}
+	var message struct {
+		Content   string `json:"content"`
+		OwnerLink string `json:"owner_link"`
+	}
+	if err := json.Unmarshal([]byte(payload), &message); err != nil || message.Content != "Thanks" || message.OwnerLink != lpAPI+"~alice" {
+		t.Errorf("Post(newMessage) with -follow = %s", payload)
+	}
+
+	// Assigning @me looks up people/+me, which redirects to the user
+	if _, err := lp.PatchEntry(lpAPI+"ubuntu/+bug/1", map[string]interface{}{"assignee_link": meRef}, nil, ""); err != nil {
+		t.Fatalf("PatchEntry(assignee_link) error = %v", err)
+	}
+	if b, _ := s.Launchpad.Bug(1); b.Tasks[0].Assignee != "alice" {
+		t.Errorf("assignee = %q, want alice", b.Tasks[0].Assignee)
+	}
+	_, err = lp.PatchEntry(lpAPI+"bugs/1", map[string]interface{}{"title": "Stale"}, nil, `"bug-1-0"`)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PatchEntry() with a stale ETag error = %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "crash.log"), []byte("Segmentation fault"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	*follow = false
+	location, err := lp.Post(lpAPI+"bugs/1", []string{"ws.op=addAttachment", "attachment=@" + filepath.Join(dir, "crash.log"), "comment=Log"})
+	if err != nil || !strings.HasPrefix(location, lpAPI+"bugs/1/+attachment/") {
+		t.Fatalf("Post(addAttachment) = %q, %v", location, err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	download := t.TempDir()
+	if err := os.Chdir(download); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := lp.Download(location + "/data"); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(download, "crash.log")); err != nil || string(data) != "Segmentation fault" {
+		t.Errorf("downloaded %q, %v", data, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fileMode returns the permissions of -output-mode, ok is false when it isn't set
+func fileMode() (mode os.FileMode, ok bool, err error) {
+	if *outputMode == "" {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseUint(*outputMode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, false, fmt.Errorf("Invalid -output-mode '%s', use octal permissions such as 0644 or 0600.", *outputMode)
+	}
+	return os.FileMode(value), true, nil
+}
+
+// atomicFile is written next to its target and renamed over it by Commit, so that the
+// target keeps its previous content until the new one is complete. Targets that can't be
+// replaced, such as /dev/stdout or a FIFO, are written directly.
+type atomicFile struct {
+	*os.File
+	path   string
+	direct bool
+}
+
+// createTemp creates a new file in dir like os.CreateTemp, but with the permissions 0666 less the umask
+func createTemp(dir string, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// createAtomic starts writing the file at path. It gets the permissions of -output-mode, or keeps those of
+// the file it replaces, or else gets 0666 less the umask like any new file.
+func createAtomic(path string) (*atomicFile, error) {
+	mode, explicit, err := fileMode()
+	if err != nil {
+		return nil, err
+	}
+	target := path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		target = resolved
+	}
+	info, statErr := os.Stat(target)
+	if statErr == nil && !info.Mode().IsRegular() {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &atomicFile{File: file, path: path, direct: true}, nil
+	}
+	if statErr == nil && !explicit {
+		mode, explicit = info.Mode().Perm(), true
+	}
+	file, err := createTemp(filepath.Dir(target), "."+filepath.Base(target)+"-")
+	if err != nil {
+		if statErr != nil {
+			return nil, err
+		}
+		// The directory can't be written to, but the file itself may be
+		file, openErr := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC, 0)
+		if openErr != nil {
+			return nil, err
+		}
+		return &atomicFile{File: file, path: target, direct: true}, nil
+	}
+	if explicit {
+		if err := file.Chmod(mode); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, err
+		}
+	}
+	return &atomicFile{File: file, path: target}, nil
+}
+
+// Commit replaces the target with the complete file
+func (f *atomicFile) Commit() error {
+	if f.direct {
+		return f.File.Close()
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort drops the file and leaves the target untouched, unless it is written directly
+func (f *atomicFile) Abort() {
+	f.File.Close()
+	if !f.direct {
+		os.Remove(f.Name())
+	}
+}
+
+// writeOutput streams the result of the command to the -output file, or to stdout followed by a newline
+func writeOutput(body io.Reader) error {
+	if *output == "" {
+		if _, err := io.Copy(os.Stdout, body); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	}
+	if *appendOutput {
+		return appendLine(*output, body)
+	}
+	file, err := createAtomic(*output)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(file, body)
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	if *debug {
+		log.Printf("OUTPUT: %d bytes to %s", size, *output)
+	}
+	return file.Commit()
+}
+
+// appendLine appends the body to the file at path as one line. The body is first written to a temporary
+// file, so that a failed request appends nothing and concurrent runs don't interleave their lines.
+func appendLine(path string, body io.Reader) error {
+	mode, explicit, err := fileMode()
+	if err != nil {
+		return err
+	}
+	if !explicit {
+		mode = 0666
+	}
+	tmp, err := os.CreateTemp("", "lp-api-append-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	line := &compactWriter{w: tmp}
+	if _, err := io.Copy(line, body); err != nil {
+		return err
+	}
+	if !line.started {
+		return nil
+	}
+	if line.last != '\n' {
+		if _, err := tmp.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(file, tmp)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if *debug {
+		log.Printf("OUTPUT: %d bytes appended to %s", size, path)
+	}
+	return file.Close()
+}
+
+// compactWriter removes the whitespace between the tokens of a JSON document so that it fits on one
+// line, and leaves other documents as they are apart from their leading whitespace
+type compactWriter struct {
+	w        io.Writer
+	started  bool
+	isJSON   bool
+	inString bool
+	escaped  bool
+	last     byte
+}
+
+func (c *compactWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		space := b == ' ' || b == '\t' || b == '\n' || b == '\r'
+		if !c.started {
+			if space {
+				continue
+			}
+			c.started = true
+			c.isJSON = b == '{' || b == '['
+		}
+		if c.isJSON {
+			switch {
+			case c.escaped:
+				c.escaped = false
+			case c.inString && b == '\\':
+				c.escaped = true
+			case b == '"':
+				c.inString = !c.inString
+			case !c.inString && space:
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	if len(out) > 0 {
+		c.last = out[len(out)-1]
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompactWriter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"{\n  \"title\": \"a  b\",\n  \"tags\": [ \"x\" ]\n}\n", `{"title":"a  b","tags":["x"]}`},
+		{`  {"quote": "say \"hi\" ", "slash": "\\" , "n": 1}`, `{"quote":"say \"hi\" ","slash":"\\","n":1}`},
+		{"[ 1,\n 2 ]", "[1,2]"},
+		{"\nhttps://api.launchpad.net/devel/bugs/1 ok\n", "https://api.launchpad.net/devel/bugs/1 ok\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := &compactWriter{w: &buf}
+		// Write one byte at a time to cover the state kept between writes
+		for i := 0; i < len(tt.input); i++ {
+			w.Write([]byte{tt.input[i]})
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("compactWriter(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// failingReader returns some data and then fails like an interrupted response
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+	backupOutput, backupAppend, backupMode := *output, *appendOutput, *outputMode
+	t.Cleanup(func() { *output, *appendOutput, *outputMode = backupOutput, backupAppend, backupMode })
+	*output = filepath.Join(dir, "bug.json")
+
+	if err := writeOutput(strings.NewReader(`{"id": 1}`)); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+	if err := writeOutput(&failingReader{data: `{"id": 2, "tit`}); err == nil {
+		t.Error("writeOutput() of an interrupted body succeeded")
+	}
+	if data, err := os.ReadFile(*output); err != nil || string(data) != `{"id": 1}` {
+		t.Errorf("-output after an interrupted body = %q, %v, want the previous content", data, err)
+	}
+	// A new file gets the permissions of any file created by the process, 0666 less the umask
+	reference, err := os.Create(filepath.Join(t.TempDir(), "reference"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference.Close()
+	want, _ := os.Stat(reference.Name())
+	if fi, err := os.Stat(*output); err != nil || fi.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("-output permissions = %v, %v, want %v", fi.Mode().Perm(), err, want.Mode().Perm())
+	}
+
+	*output = filepath.Join(dir, "tasks.ndjson")
+	*appendOutput = true
+	*outputMode = "0600"
+	for _, body := range []io.Reader{
+		strings.NewReader("{\n  \"id\": 1\n}"),
+		&failingReader{data: `{"id": 2`},
+		strings.NewReader(`{"id": 3}` + "\n"),
+	} {
+		writeOutput(body)
+	}
+	if data, err := os.ReadFile(*output); err != nil || string(data) != "{\"id\":1}\n{\"id\":3}\n" {
+		t.Errorf("-append file = %q, %v", data, err)
+	}
+	if fi, err := os.Stat(*output); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("-append permissions = %v, %v, want 0600", fi.Mode().Perm(), err)
+	}
+
+	*outputMode = "rw-r--r--"
+	if err := writeOutput(strings.NewReader("{}")); err == nil || !strings.Contains(err.Error(), "Invalid -output-mode") {
+		t.Errorf("writeOutput() with an invalid mode error = %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files in the output directory, want no temporary file left", len(entries))
+	}
+}
+
+func TestCreateAtomic_targets(t *testing.T) {
+	dir := t.TempDir()
+	backupMode := *outputMode
+	t.Cleanup(func() { *outputMode = backupMode })
+	write := func(path string, content string) error {
+		file, err := createAtomic(path)
+		if err != nil {
+			return err
+		}
+		if _, err := file.WriteString(content); err != nil {
+			file.Abort()
+			return err
+		}
+		return file.Commit()
+	}
+
+	// A replaced file keeps its permissions, unless -output-mode is set
+	private := filepath.Join(dir, "private.json")
+	if err := os.WriteFile(private, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	*outputMode = ""
+	if err := write(private, `{"id": 1}`); err != nil {
+		t.Fatalf("createAtomic() error = %v", err)
+	}
+	if fi, err := os.Stat(private); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("permissions of the replaced file = %v, %v, want 0600", fi.Mode().Perm(), err)
+	}
+	*outputMode = "0640"
+	if err := write(private, `{"id": 2}`); err != nil {
+		t.Fatalf("createAtomic() error = %v", err)
+	}
+	if fi, err := os.Stat(private); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("permissions with -output-mode 0640 = %v, %v", fi.Mode().Perm(), err)
+	}
+	*outputMode = ""
+
+	// A symbolic link is kept and the file it points to is replaced
+	link := filepath.Join(dir, "link.json")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(link, `{"id": 3}`); err != nil {
+		t.Fatalf("createAtomic() of a symbolic link error = %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symbolic link was replaced, %v", err)
+	}
+	if data, err := os.ReadFile(private); err != nil || string(data) != `{"id": 3}` {
+		t.Errorf("the file of the symbolic link has %q, %v", data, err)
+	}
+
+	// Devices, also behind a symbolic link, are written directly
+	null := filepath.Join(dir, "null")
+	if err := os.Symlink(os.DevNull, null); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{os.DevNull, null} {
+		if err := write(path, "{}"); err != nil {
+			t.Errorf("createAtomic(%s) error = %v", path, err)
+		}
+	}
+	if fi, err := os.Stat(os.DevNull); err != nil || fi.Mode().IsRegular() {
+		t.Errorf("%s was replaced, %v", os.DevNull, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("%d files in the output directory, want no temporary file left", len(entries))
+	}
+
+	// The file of a directory that can't be written to is overwritten in place
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to any directory")
+	}
+	locked := filepath.Join(dir, "locked")
+	if err := os.Mkdir(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(locked, "bug.json")
+	if err := os.WriteFile(existing, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+	if err := write(existing, `{"id": 4}`); err != nil {
+		t.Errorf("createAtomic() in a read-only directory error = %v", err)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != `{"id": 4}` {
+		t.Errorf("the file in a read-only directory has %q, %v", data, err)
+	}
+}
+
+func TestDownload_output(t *testing.T) {
+	useMockServer(t)
+	lp := LaunchpadAPI{Credential: Credential{Token: "token", Secret: "secret"}}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "crash.log"), []byte("Segmentation fault"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	location, err := lp.Post(lpAPI+"bugs/1", []string{"ws.op=addAttachment", "attachment=@" + filepath.Join(dir, "crash.log"), "comment=Log"})
+	if err != nil {
+		t.Fatalf("Post(addAttachment) error = %v", err)
+	}
+
+	backupOutput, backupAppend := *output, *appendOutput
+	t.Cleanup(func() { *output, *appendOutput = backupOutput, backupAppend })
+	*output = filepath.Join(dir, "saved.log")
+	if err := lp.Download(location + "/data"); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if data, err := os.ReadFile(*output); err != nil || string(data) != "Segmentation fault" {
+		t.Errorf("downloaded %q, %v", data, err)
+	}
+
+	*appendOutput = true
+	if err := lp.Download(location + "/data"); err == nil {
+		t.Error("Download() with -append succeeded")
+	}
+}
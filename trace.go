@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// verboseOutput receives the trace of -v
+var verboseOutput io.Writer = os.Stderr
+
+// included keeps the response of the last request sent for the command itself, whose headers -i shows before the body
+var included struct {
+	sync.Mutex
+	resp *http.Response
+}
+
+// internalKey is the context key marking the requests lp-api sends on its own behalf
+type internalKey struct{}
+
+// internalRequest marks a request that lp-api sends on its own behalf, such as fetching the WADL,
+// looking up @me or getting the entry created with -follow. -i doesn't show its headers.
+func internalRequest(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), internalKey{}, true))
+}
+
+// includedHead returns the status line and the headers of the response of the command with -i, or nothing
+func includedHead() []byte {
+	included.Lock()
+	defer included.Unlock()
+	if !*include || included.resp == nil {
+		return nil
+	}
+	var head bytes.Buffer
+	writeResponse(&head, "", included.resp)
+	head.WriteString("\n")
+	return head.Bytes()
+}
+
+// withIncluded puts the head of the response of the command before the body with -i
+func withIncluded(body io.ReadCloser) io.ReadCloser {
+	head := includedHead()
+	if head == nil {
+		return body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), body), body}
+}
+
+// oauthSecret matches the parts of an OAuth Authorization header that must not be shown
+var oauthSecret = regexp.MustCompile(`(oauth_token|oauth_signature)="[^"]*"`)
+
+// redactHeader hides the credential in the value of a request header
+func redactHeader(name string, value string) string {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization":
+		return oauthSecret.ReplaceAllString(value, `$1="REDACTED"`)
+	case "Cookie":
+		return "REDACTED"
+	}
+	return value
+}
+
+// writeHeaders writes the headers sorted by name, each line starting with prefix
+func writeHeaders(w io.Writer, prefix string, header http.Header, redact bool) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if redact {
+				value = redactHeader(name, value)
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// writeRequest writes the request line and the redacted request headers like curl -v
+func writeRequest(w io.Writer, req *http.Request) {
+	fmt.Fprintf(w, "> %s %s %s\n", req.Method, req.URL.RequestURI(), req.Proto)
+	fmt.Fprintf(w, "> Host: %s\n", req.URL.Host)
+	header := req.Header.Clone()
+	if req.ContentLength > 0 && header.Get("Content-Length") == "" {
+		header.Set("Content-Length", fmt.Sprint(req.ContentLength))
+	}
+	writeHeaders(w, "> ", header, true)
+	fmt.Fprintln(w, ">")
+}
+
+// writeResponse writes the status line and the response headers
+func writeResponse(w io.Writer, prefix string, resp *http.Response) {
+	fmt.Fprintf(w, "%s%s %s\n", prefix, resp.Proto, resp.Status)
+	writeHeaders(w, prefix, resp.Header, false)
+}
+
+// withTimings reports the DNS lookup, the connection, the TLS handshake and the first byte of the response
+func withTimings(w io.Writer, req *http.Request) *http.Request {
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			fmt.Fprintf(w, "* DNS lookup took %s\n", time.Since(dnsStart))
+		},
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				fmt.Fprintf(w, "* Failed to connect to %s: %v\n", addr, err)
+				return
+			}
+			fmt.Fprintf(w, "* Connected to %s in %s\n", addr, time.Since(connectStart))
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				fmt.Fprintf(w, "* TLS handshake failed: %v\n", err)
+				return
+			}
+			fmt.Fprintf(w, "* TLS handshake took %s\n", time.Since(tlsStart))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				fmt.Fprintf(w, "* Reusing the connection to %s\n", info.Conn.RemoteAddr())
+			}
+		},
+		GotFirstResponseByte: func() {
+			fmt.Fprintf(w, "* First byte after %s\n", time.Since(start))
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// tracedClient sends its requests through send
+type tracedClient struct {
+	*http.Client
+}
+
+func (c tracedClient) Do(req *http.Request) (*http.Response, error) {
+	return send(c.Client, req)
+}
+
+// send sends the request with the client, tracing it with -v and showing the response headers with -i
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	if *verbose {
+		writeRequest(verboseOutput, req)
+		req = withTimings(verboseOutput, req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if *verbose {
+		writeResponse(verboseOutput, "< ", resp)
+		fmt.Fprintln(verboseOutput, "<")
+	}
+	if *include && req.Context().Value(internalKey{}) == nil {
+		included.Lock()
+		included.resp = resp
+		included.Unlock()
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Authorization", `OAuth realm="https://api.launchpad.net/", oauth_consumer_key="lp-api", oauth_token="abc", oauth_signature="&secret"`, `OAuth realm="https://api.launchpad.net/", oauth_consumer_key="lp-api", oauth_token="REDACTED", oauth_signature="REDACTED"`},
+		{"cookie", "session=abc", "REDACTED"},
+		{"Accept", "application/json", "application/json"},
+	}
+	for _, tt := range tests {
+		if got := redactHeader(tt.name, tt.value); got != tt.want {
+			t.Errorf("redactHeader(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("X-Lazr-Oopsid", "OOPS-1")
+		if r.URL.Path == "/devel/people/+me" {
+			w.Header().Set("X-Lazr-Oopsid", "OOPS-2")
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var traced bytes.Buffer
+	backupInclude, backupVerbose, backupVerboseOutput := *include, *verbose, verboseOutput
+	*include, *verbose = true, true
+	verboseOutput = &traced
+	t.Cleanup(func() {
+		*include, *verbose, verboseOutput = backupInclude, backupVerbose, backupVerboseOutput
+		included.resp = nil
+	})
+
+	lp := LaunchpadAPI{Credential: Credential{Key: "lp-api", Token: "token", Secret: "secret"}}
+	req, err := http.NewRequest("GET", server.URL+"/devel/bugs/1?ws.show=all", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp.SetAuthHeader(&req.Header)
+	payload, err := lp.DoProcess(req)
+	if err != nil || payload != `{}` {
+		t.Fatalf("DoProcess() = %q, %v", payload, err)
+	}
+
+	// The requests lp-api sends on its own behalf don't replace the response shown by -i
+	if _, err := lp.getInternal(server.URL + "/devel/people/+me"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(withIncluded(io.NopCloser(strings.NewReader(payload))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "HTTP/1.1 200 OK\nContent-Length: 2\nContent-Type: text/plain; charset=utf-8\n"
+	if got := string(output); !strings.HasPrefix(got, want) || !strings.Contains(got, "Etag: \"etag\"\n") || !strings.Contains(got, "X-Lazr-Oopsid: OOPS-1\n") || !strings.HasSuffix(got, "\n\n{}") {
+		t.Errorf("-i output = %q", got)
+	}
+
+	trace := traced.String()
+	for _, line := range []string{
+		"> GET /devel/bugs/1?ws.show=all HTTP/1.1\n",
+		"> Host: " + strings.TrimPrefix(server.URL, "http://") + "\n",
+		`oauth_token="REDACTED"`,
+		"* Connected to ",
+		"* First byte after ",
+		"< HTTP/1.1 200 OK\n",
+		"< X-Lazr-Oopsid: OOPS-1\n",
+	} {
+		if !strings.Contains(trace, line) {
+			t.Errorf("-v output doesn't contain %q:\n%s", line, trace)
+		}
+	}
+	if strings.Contains(trace, "secret") || strings.Contains(trace, `"token"`) {
+		t.Errorf("-v output shows the credential:\n%s", trace)
+	}
+}
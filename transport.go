@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shared keeps the transport of the process, so that the connections are reused by all the requests
+var shared struct {
+	once      sync.Once
+	transport *http.Transport
+	err       error
+}
+
+// newTransport configures a transport with keep-alive, HTTP/2, the proxy of HTTPS_PROXY and the CA bundle.
+// Responses are decompressed transparently because requests don't set Accept-Encoding themselves.
+func newTransport() (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   *connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   *connectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if *caBundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(*caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("There is no certificate in %s.", *caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return transport, nil
+}
+
+// sharedTransport returns the transport of the process
+func sharedTransport() (*http.Transport, error) {
+	shared.once.Do(func() {
+		shared.transport, shared.err = newTransport()
+	})
+	return shared.transport, shared.err
+}
+
+// idleTimeoutReader cancels a download when its body receives nothing for the idle timeout
+type idleTimeoutReader struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	stalled *atomic.Bool
+	cancel  context.CancelFunc
+}
+
+// withDownloadTimeouts gives up on a download when the response headers take longer than -timeout
+// or when the body stalls for longer than -download-idle-timeout, without limiting the whole transfer
+func withDownloadTimeouts(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	var expired atomic.Bool
+	timer := time.AfterFunc(*timeout, func() {
+		expired.Store(true)
+		cancel()
+	})
+	resp, err := send(client, req.WithContext(ctx))
+	timer.Stop()
+	if err != nil {
+		cancel()
+		if expired.Load() {
+			return nil, fmt.Errorf("Launchpad didn't answer %s within %s.", req.URL, *timeout)
+		}
+		return nil, err
+	}
+	stalled := &atomic.Bool{}
+	resp.Body = &idleTimeoutReader{
+		ReadCloser: resp.Body,
+		timer: time.AfterFunc(*downloadIdleTimeout, func() {
+			stalled.Store(true)
+			cancel()
+		}),
+		timeout: *downloadIdleTimeout,
+		stalled: stalled,
+		cancel:  cancel,
+	}
+	return resp, nil
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	if err != nil && err != io.EOF && r.stalled.Load() {
+		err = fmt.Errorf("The download received nothing for %s.", r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	r.cancel()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewTransport_caBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := *caBundle
+	t.Cleanup(func() { *caBundle = backup })
+	tests := []struct {
+		bundle     string
+		wantErr    string
+		wantGetErr bool
+	}{
+		{"", "", true},
+		{bundle, "", false},
+		{empty, "There is no certificate", false},
+		{filepath.Join(dir, "missing.pem"), "Failed to read the CA bundle", false},
+	}
+	for _, tt := range tests {
+		*caBundle = tt.bundle
+		transport, err := newTransport()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newTransport() with %q error = %v, want %q", tt.bundle, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("newTransport() with %q error = %v", tt.bundle, err)
+		}
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err != nil) != tt.wantGetErr {
+			t.Errorf("Get() with the CA bundle %q error = %v", tt.bundle, err)
+		}
+	}
+}
+
+func TestSharedTransport_reusesConnections(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	lp := LaunchpadAPI{}
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lp.DoProcess(req); err != nil {
+			t.Fatalf("DoProcess() error = %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("3 requests opened %d connections, want 1", n)
+	}
+}
+
+func TestWithDownloadTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			<-release
+		case "/stalled":
+			w.Write([]byte("first bytes"))
+			w.(http.Flusher).Flush()
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	backupTimeout, backupIdle := *timeout, *downloadIdleTimeout
+	*timeout, *downloadIdleTimeout = 100*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { *timeout, *downloadIdleTimeout = backupTimeout, backupIdle })
+
+	client := &http.Client{}
+	req, _ := http.NewRequest("GET", server.URL+"/slow-headers", nil)
+	if _, err := withDownloadTimeouts(client, req); err == nil || !strings.Contains(err.Error(), "didn't answer") {
+		t.Errorf("withDownloadTimeouts() without response headers error = %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/stalled", nil)
+	resp, err := withDownloadTimeouts(client, req)
+	if err != nil {
+		t.Fatalf("withDownloadTimeouts() error = %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if string(data) != "first bytes" || err == nil || !strings.Contains(err.Error(), "received nothing") {
+		t.Errorf("reading a stalled download = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a string, b string) int {
+	x, y := []rune(a), []rune(b)
+	prev := make([]int, len(y)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		cur := make([]int, len(y)+1)
+		cur[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			cur[j] = cur[j-1] + 1
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+	return prev[len(y)]
+}
+
+// closestMatch returns the candidate closest to name, ignoring case, or an empty string when none is close enough
+func closestMatch(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/2 + 1
+	for _, candidate := range candidates {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// didYouMean suggests the closest candidate to name
+func didYouMean(name string, candidates []string) string {
+	if match := closestMatch(name, candidates); match != "" {
+		return fmt.Sprintf(" Did you mean '%s'?", match)
+	}
+	return ""
+}
+
+// enumValues splits a parameter value into the values to check against its options.
+// A JSON list, as sent by key:=value, holds several of them.
+func enumValues(value string) []string {
+	if strings.HasPrefix(value, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err == nil {
+			return values
+		}
+	}
+	return []string{value}
+}
+
+// resourceTypes caches the resource types of the resources looked up for validation
+var resourceTypes = make(map[string]*ResourceType)
+
+// pathShapes lists the shapes of entry paths beyond those pathType knows, with the resource types they can have
+var pathShapes = []struct {
+	path  *regexp.Regexp
+	types []string
+}{
+	{regexp.MustCompile(`^~[^/]+/\+archive/[^/]+/[^/]+$`), []string{"archive"}},
+	{regexp.MustCompile(`^[^/~+][^/]*/\+bug/[0-9]+$`), []string{"bug_task"}},
+	{regexp.MustCompile(`^[^/~+][^/]*/\+source/[^/]+$`), []string{"distribution_source_package"}},
+	{regexp.MustCompile(`^[^/~+][^/]*/\+milestone/[^/]+$`), []string{"milestone"}},
+	{regexp.MustCompile(`^[^/~+][^/]*/[^/+][^/]*$`), []string{"distro_series", "project_series"}},
+	{regexp.MustCompile(`^[^/~+][^/]*$`), []string{"distribution", "project", "project_group"}},
+}
+
+// pathTypes returns the resource types the resource can have from its path alone, without asking Launchpad
+func pathTypes(w *WADL, resource string) []*ResourceType {
+	resource = strings.SplitN(resource, "?", 2)[0]
+	if rt := pathType(w, resource); rt != nil {
+		return []*ResourceType{rt}
+	}
+	path := strings.Trim(strings.TrimPrefix(resource, lpAPI), "/")
+	for _, shape := range pathShapes {
+		if !shape.path.MatchString(path) {
+			continue
+		}
+		var types []*ResourceType
+		for _, name := range shape.types {
+			if rt := w.ResourceType(name); rt != nil {
+				types = append(types, rt)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// targetTypes finds the resource types the named operation may be invoked on. They are worked out from the
+// path and the collections of the WADL, and only the resources whose path tells nothing are looked up.
+func (lp *LaunchpadAPI) targetTypes(w *WADL, resource string, name string) ([]*ResourceType, error) {
+	candidates := pathTypes(w, resource)
+	var matching []*ResourceType
+	for _, rt := range candidates {
+		if rt.Operation(name) != nil {
+			matching = append(matching, rt)
+		}
+	}
+	if len(matching) > 0 {
+		return matching, nil
+	}
+	if len(candidates) == 1 {
+		return candidates, nil
+	}
+	resource = strings.SplitN(resource, "?", 2)[0]
+	if rt, ok := resourceTypes[resource]; ok {
+		return []*ResourceType{rt}, nil
+	}
+	rt, err := lp.ResourceTypeOf(w, resource)
+	if err != nil {
+		return nil, err
+	}
+	resourceTypes[resource] = rt
+	return []*ResourceType{rt}, nil
+}
+
+// CheckOperation checks a named operation and its parameters against the resource type it is invoked on
+func CheckOperation(rt *ResourceType, method string, params map[string][]string) error {
+	name := params["ws.op"][0]
+	var op, other *Operation
+	var names []string
+	for _, candidate := range rt.Operations {
+		names = append(names, candidate.Name)
+		if candidate.Name == name {
+			if candidate.Method == method {
+				op = candidate
+			} else {
+				other = candidate
+			}
+		}
+	}
+	if op == nil && other != nil {
+		return fmt.Errorf("'%s' is a %s operation on %s, use `lp-api %s` instead.", name, other.Method, rt.Name, strings.ToLower(other.Method))
+	}
+	if op == nil {
+		if len(names) == 0 {
+			return fmt.Errorf("There is no named operation on %s.", rt.Name)
+		}
+		return fmt.Errorf("There is no '%s' named operation on %s.%s", name, rt.Name, didYouMean(name, names))
+	}
+
+	var problems []string
+	var keys []string
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var paramNames []string
+	for _, param := range op.Params {
+		paramNames = append(paramNames, param.Name)
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, "ws.") {
+			continue
+		}
+		param := op.Param(key)
+		if param == nil {
+			problems = append(problems, fmt.Sprintf("'%s' is not a parameter of %s.%s", key, name, didYouMean(key, paramNames)))
+			continue
+		}
+		if len(param.Options) == 0 {
+			continue
+		}
+		for _, value := range params[key] {
+			for _, v := range enumValues(value) {
+				if !contains(param.Options, v) {
+					problems = append(problems, fmt.Sprintf("'%s' is not a valid %s.%s", v, key, didYouMean(v, param.Options)))
+				}
+			}
+		}
+	}
+	for _, param := range op.Params {
+		if _, ok := params[param.Name]; param.Required && !ok {
+			problems = append(problems, fmt.Sprintf("'%s' is required by %s.", param.Name, name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid %s on %s:\n\t%s", name, rt.Name, strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// contains checks if list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOperation checks a named operation sent with method to resource before it is sent, unless -no-validate is given.
+// Only resources of the active service root are checked, and nothing is reported when the WADL or the resource type is unavailable.
+func (lp *LaunchpadAPI) ValidateOperation(resource string, method string, params map[string][]string) error {
+	if *noValidate || len(params["ws.op"]) == 0 || !strings.HasPrefix(resource, lpAPI) {
+		return nil
+	}
+	w, err := lp.LoadWADL()
+	if err != nil {
+		if *debug {
+			log.Print("Skipping validation: ", err)
+		}
+		return nil
+	}
+	types, err := lp.targetTypes(w, resource, params["ws.op"][0])
+	if err != nil {
+		if *debug {
+			log.Print("Skipping validation: ", err)
+		}
+		return nil
+	}
+	// The path of a pillar such as ubuntu fits several types, any of them may accept the operation
+	var first error
+	for _, rt := range types {
+		err := CheckOperation(rt, method, params)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return fmt.Errorf("%v\nUse -no-validate to send it anyway.", first)
+}
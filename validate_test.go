@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClosestMatch(t *testing.T) {
+	ops := []string{"searchTasks", "getSeries", "getMilestone"}
+	statuses := []string{"New", "Incomplete", "Fix Committed", "Fix Released"}
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"serachTasks", ops, "searchTasks"},
+		{"searchtasks", ops, "searchTasks"},
+		{"getseries", ops, "getSeries"},
+		{"Fix Relased", statuses, "Fix Released"},
+		{"new", statuses, "New"},
+		{"createBug", ops, ""},
+		{"Wontfix", statuses, ""},
+	}
+	for _, tt := range tests {
+		if got := closestMatch(tt.name, tt.candidates); got != tt.want {
+			t.Errorf("closestMatch(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOperation(t *testing.T) {
+	w := loadTestWADL(t)
+	tests := []struct {
+		name   string
+		rt     string
+		method string
+		params map[string][]string
+		want   string
+	}{
+		{"valid GET", "distribution", "GET", map[string][]string{"ws.op": {"searchTasks"}, "status": {"New", "Fix Released"}, "ws.show": {"total_size"}}, ""},
+		{"valid POST", "bug", "POST", map[string][]string{"ws.op": {"newMessage"}, "content": {"Thanks"}}, ""},
+		{"enum list", "bugs", "POST", map[string][]string{"ws.op": {"createBug"}, "title": {"t"}, "description": {"d"}, "target": {"ubuntu"}, "information_type": {`["Public"]`}}, ""},
+		{"typo in operation", "distribution", "GET", map[string][]string{"ws.op": {"serachTasks"}}, "There is no 'serachTasks' named operation on distribution. Did you mean 'searchTasks'?"},
+		{"unknown operation", "bug", "POST", map[string][]string{"ws.op": {"frobnicate"}}, "There is no 'frobnicate' named operation on bug."},
+		{"wrong method", "bug", "POST", map[string][]string{"ws.op": {"isUserAffected"}}, "'isUserAffected' is a GET operation on bug, use `lp-api get` instead."},
+		{"typo in enum", "distribution", "GET", map[string][]string{"ws.op": {"searchTasks"}, "status": {"Fix Relased"}}, "'Fix Relased' is not a valid status. Did you mean 'Fix Released'?"},
+		{"typo in parameter", "bug", "POST", map[string][]string{"ws.op": {"newMessage"}, "content": {"Thanks"}, "subjet": {"Re"}}, "'subjet' is not a parameter of newMessage. Did you mean 'subject'?"},
+		{"missing parameter", "bug", "POST", map[string][]string{"ws.op": {"newMessage"}}, "'content' is required by newMessage."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckOperation(w.ResourceType(tt.rt), tt.method, tt.params)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("CheckOperation() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CheckOperation() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOperation(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		w.Write([]byte(`{"name": "ubuntu", "resource_type_link": "https://api.launchpad.net/devel/#distribution"}`))
+	}))
+	defer server.Close()
+
+	backup := lpAPI
+	lpAPI = server.URL + "/devel/"
+	loadedWADL[lpAPI] = loadTestWADL(t)
+	t.Cleanup(func() {
+		delete(loadedWADL, lpAPI)
+		lpAPI = backup
+		*noValidate = false
+	})
+
+	lp := LaunchpadAPI{}
+	// The type of a pillar is known from its path without looking it up
+	_, err := lp.Get(lpAPI+"ubuntu", []string{"ws.op==serachTasks"})
+	if err == nil || !strings.Contains(err.Error(), "Did you mean 'searchTasks'?") {
+		t.Errorf("Get() error = %v", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("requests = %v, want none", requests)
+	}
+	requests = nil
+	if _, err := lp.Get(lpAPI+"ubuntu", []string{"ws.op==searchTasks", "status==New"}); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if len(requests) != 1 || !strings.Contains(requests[0], "ws.op=searchTasks") {
+		t.Errorf("requests = %v, want only the operation", requests)
+	}
+
+	// Other resources are looked up once
+	requests = nil
+	for i := 0; i < 2; i++ {
+		_, err = lp.Get(lpAPI+"ubuntu/+livefs/x", []string{"ws.op==serachTasks"})
+		if err == nil || !strings.Contains(err.Error(), "Did you mean 'searchTasks'?") {
+			t.Errorf("Get() error = %v", err)
+		}
+	}
+	if len(requests) != 1 || requests[0] != "GET /devel/ubuntu/+livefs/x" {
+		t.Errorf("requests = %v, want only one lookup of the resource type", requests)
+	}
+
+	// Top-level collections are known without looking them up
+	requests = nil
+	_, err = lp.Post(lpAPI+"bugs", []string{"ws.op=createBug", "title=Crash"})
+	if err == nil || !strings.Contains(err.Error(), "'description' is required by createBug.") || !strings.Contains(err.Error(), "-no-validate") {
+		t.Errorf("Post() error = %v", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("requests = %v, want none", requests)
+	}
+
+	*noValidate = true
+	if _, err := lp.Post(lpAPI+"bugs", []string{"ws.op=createBug", "title=Crash"}); err != nil {
+		t.Errorf("Post() with -no-validate error = %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("requests = %v, want the POST", requests)
+	}
+}
+
+func TestPathTypes(t *testing.T) {
+	w := loadTestWADL(t)
+	tests := []struct {
+		resource string
+		want     []string
+	}{
+		{"", []string{"service-root"}},
+		{"bugs", []string{"bugs"}},
+		{"bugs/1", []string{"bug"}},
+		{"~alice", []string{"person"}},
+		{"ubuntu", []string{"distribution"}},
+		{"ubuntu?ws.op=searchTasks", []string{"distribution"}},
+		{"~alice/+archive/ubuntu/ppa", []string{"archive"}},
+		{"ubuntu/+bug/1", []string{"bug_task"}},
+		{"ubuntu/+livefs/x", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, rt := range pathTypes(w, lpAPI+tt.resource) {
+			got = append(got, rt.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pathTypes(%q) = %v, want %v", tt.resource, got, tt.want)
+		}
+	}
+}
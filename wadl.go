@@ -0,0 +1,542 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WADL is the parsed description of the Launchpad web service published for one service root
+type WADL struct {
+	Base string
+	// Collections maps the top-level collections of the service root, such as "bugs", to their resource types
+	Collections   map[string]string
+	ResourceTypes map[string]*ResourceType
+}
+
+// ResourceType describes an entry, a collection or the service root
+type ResourceType struct {
+	Name       string
+	Doc        string
+	Fields     []*Field
+	Operations []*Operation
+	// Entries is the resource type of the entries of a collection, empty for entries
+	Entries string
+}
+
+// Field is a field of an entry representation
+type Field struct {
+	Name     string
+	Doc      string
+	Type     string
+	LinkType string
+	Options  []string
+	Writable bool
+}
+
+// Operation is a named operation invoked with ws.op
+type Operation struct {
+	Name   string
+	Method string
+	Doc    string
+	Params []*Param
+	// Returns is the resource type returned by the operation, ReturnsCollection tells if it is a page of them
+	Returns           string
+	ReturnsCollection bool
+	// Creates is the resource type of the entry created by a factory operation, whose URL is in the Location header
+	Creates   string
+	Multipart bool
+}
+
+// Param is a parameter of a named operation
+type Param struct {
+	Name     string
+	Doc      string
+	Type     string
+	LinkType string
+	Required bool
+	Options  []string
+}
+
+// Field returns the named field or nil
+func (rt *ResourceType) Field(name string) *Field {
+	for _, field := range rt.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// Operation returns the named operation or nil
+func (rt *ResourceType) Operation(name string) *Operation {
+	for _, op := range rt.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
+
+// IsCollection checks if the resource type describes a collection
+func (rt *ResourceType) IsCollection() bool {
+	return rt.Entries != ""
+}
+
+// Param returns the named parameter or nil
+func (op *Operation) Param(name string) *Param {
+	for _, param := range op.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// ResourceType returns the named resource type or nil
+func (w *WADL) ResourceType(name string) *ResourceType {
+	return w.ResourceTypes[name]
+}
+
+// ResourceTypeNames returns the names of all resource types in alphabetical order
+func (w *WADL) ResourceTypeNames() []string {
+	names := make([]string, 0, len(w.ResourceTypes))
+	for name := range w.ResourceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The wadl* types mirror the XML published by Launchpad
+
+type wadlApplication struct {
+	Resources       []wadlResources      `xml:"resources"`
+	ResourceTypes   []wadlResourceType   `xml:"resource_type"`
+	Representations []wadlRepresentation `xml:"representation"`
+}
+
+type wadlResources struct {
+	Base string `xml:"base,attr"`
+}
+
+type wadlDoc struct {
+	Inner string `xml:",innerxml"`
+}
+
+type wadlResourceType struct {
+	ID      string       `xml:"id,attr"`
+	Doc     wadlDoc      `xml:"doc"`
+	Methods []wadlMethod `xml:"method"`
+}
+
+type wadlMethod struct {
+	ID        string         `xml:"id,attr"`
+	Name      string         `xml:"name,attr"`
+	Doc       wadlDoc        `xml:"doc"`
+	Request   wadlRequest    `xml:"request"`
+	Responses []wadlResponse `xml:"response"`
+}
+
+type wadlRequest struct {
+	Params          []wadlParam          `xml:"param"`
+	Representations []wadlRepresentation `xml:"representation"`
+}
+
+type wadlResponse struct {
+	Params          []wadlParam          `xml:"param"`
+	Representations []wadlRepresentation `xml:"representation"`
+}
+
+type wadlRepresentation struct {
+	ID        string      `xml:"id,attr"`
+	Href      string      `xml:"href,attr"`
+	MediaType string      `xml:"mediaType,attr"`
+	Params    []wadlParam `xml:"param"`
+}
+
+type wadlParam struct {
+	Name     string       `xml:"name,attr"`
+	Style    string       `xml:"style,attr"`
+	Type     string       `xml:"type,attr"`
+	Required string       `xml:"required,attr"`
+	Fixed    string       `xml:"fixed,attr"`
+	Doc      wadlDoc      `xml:"doc"`
+	Options  []wadlOption `xml:"option"`
+	Link     *wadlLink    `xml:"link"`
+}
+
+type wadlOption struct {
+	Value string `xml:"value,attr"`
+}
+
+type wadlLink struct {
+	ResourceType string `xml:"resource_type,attr"`
+}
+
+var (
+	docParagraph = regexp.MustCompile(`</[^>]*p>`)
+	docTag       = regexp.MustCompile(`<[^>]*>`)
+	docSpaces    = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// text converts the XHTML documentation to plain text with one line per paragraph
+func (d wadlDoc) text() string {
+	inner := docParagraph.ReplaceAllString(d.Inner, "\n")
+	inner = docTag.ReplaceAllString(inner, " ")
+	inner = html.UnescapeString(inner)
+	var lines []string
+	for _, line := range strings.Split(inner, "\n") {
+		if line = strings.TrimSpace(docSpaces.ReplaceAllString(line, " ")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fragment returns the part of a WADL reference after '#', such as "bug" for https://api.launchpad.net/devel/#bug
+func fragment(ref string) string {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ref
+}
+
+// paramType describes the type of a WADL parameter: string, int, boolean, dateTime, binary, link...
+func paramType(p wadlParam) (string, string) {
+	if p.Link != nil {
+		return "link", fragment(p.Link.ResourceType)
+	}
+	if p.Type == "" {
+		return "string", ""
+	}
+	return strings.TrimPrefix(p.Type, "xsd:"), ""
+}
+
+func optionValues(options []wadlOption) []string {
+	var values []string
+	for _, option := range options {
+		values = append(values, option.Value)
+	}
+	return values
+}
+
+// ParseWADL parses the WADL document describing a Launchpad service root
+func ParseWADL(r io.Reader) (*WADL, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	var app wadlApplication
+	if err := decoder.Decode(&app); err != nil {
+		return nil, fmt.Errorf("Invalid WADL: %v", err)
+	}
+	if len(app.ResourceTypes) == 0 {
+		return nil, errors.New("Invalid WADL: no resource types")
+	}
+
+	w := &WADL{
+		Collections:   make(map[string]string),
+		ResourceTypes: make(map[string]*ResourceType),
+	}
+	if len(app.Resources) > 0 {
+		w.Base = app.Resources[0].Base
+	}
+
+	representations := make(map[string]wadlRepresentation)
+	for _, representation := range app.Representations {
+		representations[representation.ID] = representation
+	}
+
+	for _, rawType := range app.ResourceTypes {
+		rt := &ResourceType{Name: rawType.ID, Doc: rawType.Doc.text()}
+		var fields, writable string
+		for _, method := range rawType.Methods {
+			var op *Operation
+			for _, param := range method.Request.Params {
+				if param.Name == "ws.op" {
+					op = &Operation{Name: param.Fixed, Method: method.Name}
+				}
+			}
+			for _, representation := range method.Request.Representations {
+				for _, param := range representation.Params {
+					if param.Name == "ws.op" {
+						op = &Operation{Name: param.Fixed, Method: method.Name, Multipart: representation.MediaType == "multipart/form-data"}
+					}
+				}
+			}
+
+			if op == nil {
+				// The standard methods on the resource itself tell which representations describe it
+				switch method.Name {
+				case "GET":
+					for _, response := range method.Responses {
+						for _, representation := range response.Representations {
+							if representation.Href != "" && fields == "" {
+								fields = fragment(representation.Href)
+							}
+						}
+					}
+				case "PATCH":
+					for _, representation := range method.Request.Representations {
+						writable = fragment(representation.Href)
+					}
+				}
+				continue
+			}
+
+			op.Doc = method.Doc.text()
+			params := method.Request.Params
+			for _, representation := range method.Request.Representations {
+				params = append(params, representation.Params...)
+			}
+			for _, param := range params {
+				if param.Name == "ws.op" {
+					continue
+				}
+				p := &Param{Name: param.Name, Doc: param.Doc.text(), Required: param.Required == "true", Options: optionValues(param.Options)}
+				p.Type, p.LinkType = paramType(param)
+				op.Params = append(op.Params, p)
+			}
+			for _, response := range method.Responses {
+				for _, param := range response.Params {
+					if param.Style == "header" && param.Name == "Location" && param.Link != nil {
+						op.Creates = fragment(param.Link.ResourceType)
+					}
+				}
+				for _, representation := range response.Representations {
+					if representation.Href == "" {
+						continue
+					}
+					returns := fragment(representation.Href)
+					switch {
+					case strings.HasSuffix(returns, "-page"):
+						op.Returns, op.ReturnsCollection = strings.TrimSuffix(returns, "-page"), true
+					case strings.HasSuffix(returns, "-full"):
+						op.Returns = strings.TrimSuffix(returns, "-full")
+					}
+				}
+			}
+			rt.Operations = append(rt.Operations, op)
+		}
+
+		switch {
+		case strings.HasSuffix(fields, "-page"):
+			rt.Entries = strings.TrimSuffix(fields, "-page")
+		case fields != "":
+			editable := make(map[string]bool)
+			for _, param := range representations[writable].Params {
+				editable[param.Name] = true
+			}
+			for _, param := range representations[fields].Params {
+				f := &Field{Name: param.Name, Doc: param.Doc.text(), Options: optionValues(param.Options), Writable: editable[param.Name]}
+				f.Type, f.LinkType = paramType(param)
+				rt.Fields = append(rt.Fields, f)
+			}
+		}
+		sort.Slice(rt.Operations, func(i, j int) bool {
+			return rt.Operations[i].Name < rt.Operations[j].Name
+		})
+		w.ResourceTypes[rt.Name] = rt
+	}
+
+	if root, ok := w.ResourceTypes["service-root"]; ok {
+		for _, field := range root.Fields {
+			if strings.HasSuffix(field.Name, "_collection_link") {
+				w.Collections[strings.TrimSuffix(field.Name, "_collection_link")] = field.LinkType
+			}
+		}
+	}
+	return w, nil
+}
+
+// cacheDir returns the cache directory of lp-api, such as ~/.cache/lp-api
+func cacheDir() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		var err error
+		dir, err = os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "lp-api"), nil
+}
+
+// wadlCachePath returns where the WADL of a service root is cached, such as ~/.cache/lp-api/wadl/api.launchpad.net-devel.xml
+func wadlCachePath(root string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(root)
+	if err != nil {
+		return "", err
+	}
+	version := strings.Trim(u.Path, "/")
+	if version == "" {
+		version = "root"
+	}
+	name := u.Host + "-" + strings.ReplaceAll(version, "/", "-") + ".xml"
+	return filepath.Join(dir, "wadl", name), nil
+}
+
+// fetchWADL downloads the WADL of the active service root and stores it at cachePath once it is known to be valid
+func (lp *LaunchpadAPI) fetchWADL(cachePath string) (*WADL, error) {
+	if *debug {
+		log.Print("WADL ", lpAPI)
+	}
+	req, err := http.NewRequest("GET", lpAPI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.sun.wadl+xml")
+	lp.SetAuthHeader(&req.Header)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(cachePath), ".wadl-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	body, _, err := lp.DoStream(internalRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	// The document is parsed while it is written to the cache, instead of being held in memory
+	w, err := ParseWADL(io.TeeReader(body, file))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return w, os.Rename(file.Name(), cachePath)
+}
+
+// loadedWADL keeps the WADL already parsed in this process for each service root
+var loadedWADL = make(map[string]*WADL)
+
+// LoadWADL returns the description of the active service root. It is read from the
+// on-disk cache, which is refreshed from Launchpad once it is older than -wadl-expiry.
+func (lp *LaunchpadAPI) LoadWADL() (*WADL, error) {
+	if w, ok := loadedWADL[lpAPI]; ok {
+		return w, nil
+	}
+	cachePath, err := wadlCachePath(lpAPI)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(cachePath)
+	if err != nil || time.Since(fi.ModTime()) > *wadlExpiry {
+		w, err := lp.fetchWADL(cachePath)
+		if err == nil {
+			loadedWADL[lpAPI] = w
+			return w, nil
+		}
+		if fi == nil {
+			return nil, fmt.Errorf("Unable to get the WADL of %s: %v", lpAPI, err)
+		}
+		// A stale description is better than none
+		log.Print("Using the stale WADL cache ", cachePath, ": ", err)
+	}
+	return readWADLCache(cachePath)
+}
+
+// CachedWADL returns the description of the active service root from the on-disk cache only, however old it is
+func CachedWADL() (*WADL, error) {
+	if w, ok := loadedWADL[lpAPI]; ok {
+		return w, nil
+	}
+	cachePath, err := wadlCachePath(lpAPI)
+	if err != nil {
+		return nil, err
+	}
+	return readWADLCache(cachePath)
+}
+
+// operationParamType returns the WADL type of the parameter key of the named operation wsop, sent with
+// method to resource, or "" when no WADL is loaded or cached. Parameters the WADL doesn't describe are
+// strings. Only the WADL already at hand is looked at: classifying an argument never fetches it.
+func operationParamType(resource string, method string, wsop string, key string) string {
+	w, err := CachedWADL()
+	if err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(resource, lpAPI) || wsop == "" {
+		return "string"
+	}
+	op := findOperation(w, pathType(w, strings.SplitN(resource, "?", 2)[0]), method, wsop)
+	if op == nil {
+		op = findOperation(w, nil, method, wsop)
+	}
+	if op == nil {
+		return "string"
+	}
+	// attachment is the alias lp-api keeps for the data parameter of addAttachment
+	if key == "attachment" && op.Param(key) == nil {
+		key = "data"
+	}
+	if param := op.Param(key); param != nil {
+		return param.Type
+	}
+	return "string"
+}
+
+// entryFieldType returns the WADL type of the field key of the entry at resource, or "" when no WADL
+// is loaded or cached. Like operationParamType, it never fetches the WADL.
+func entryFieldType(resource string, key string) string {
+	w, err := CachedWADL()
+	if err != nil {
+		return ""
+	}
+	if rt := pathType(w, strings.SplitN(resource, "?", 2)[0]); rt != nil {
+		if field := rt.Field(key); field != nil {
+			return field.Type
+		}
+	}
+	return "string"
+}
+
+// readWADLCache parses the cached description of the active service root
+func readWADLCache(cachePath string) (*WADL, error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w, err := ParseWADL(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cachePath, err)
+	}
+	if *debug {
+		log.Printf("Loaded %d resource types from %s", len(w.ResourceTypes), cachePath)
+	}
+	loadedWADL[lpAPI] = w
+	return w, nil
+}
+
+// EntryType returns the resource type of an entry from the resource_type_link of its representation, or nil
+func (w *WADL) EntryType(entry map[string]interface{}) *ResourceType {
+	link, _ := entry["resource_type_link"].(string)
+	if link == "" {
+		return nil
+	}
+	return w.ResourceType(fragment(link))
+}
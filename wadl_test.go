@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestWADL(t *testing.T) *WADL {
+	t.Helper()
+	file, err := os.Open("testdata/wadl-devel.xml")
+	if err != nil {
+		t.Fatalf("Failed to open WADL: %v", err)
+	}
+	defer file.Close()
+	w, err := ParseWADL(file)
+	if err != nil {
+		t.Fatalf("ParseWADL() error = %v", err)
+	}
+	return w
+}
+
+func TestParseWADL(t *testing.T) {
+	w := loadTestWADL(t)
+
+	if w.Base != "https://api.launchpad.net/devel/" {
+		t.Errorf("Base = %q", w.Base)
+	}
+	if w.Collections["bugs"] != "bugs" || w.Collections["people"] != "people" {
+		t.Errorf("Collections = %v", w.Collections)
+	}
+
+	bug := w.ResourceType("bug")
+	if bug == nil {
+		t.Fatal("ResourceType(bug) = nil")
+	}
+	if bug.Doc != "A bug." || bug.IsCollection() {
+		t.Errorf("bug = %q, collection %v", bug.Doc, bug.IsCollection())
+	}
+
+	title := bug.Field("title")
+	if title == nil || !title.Writable || title.Type != "string" || title.Doc != "Summary" {
+		t.Errorf("title field = %+v", title)
+	}
+	if id := bug.Field("id"); id == nil || id.Writable || id.Type != "int" {
+		t.Errorf("id field = %+v", id)
+	}
+	if owner := bug.Field("owner_link"); owner == nil || owner.Type != "link" || owner.LinkType != "person" || owner.Writable {
+		t.Errorf("owner_link field = %+v", owner)
+	}
+	if tasks := bug.Field("bug_tasks_collection_link"); tasks == nil || tasks.LinkType != "bug_task-page-resource" {
+		t.Errorf("bug_tasks_collection_link field = %+v", tasks)
+	}
+	if info := bug.Field("information_type"); info == nil || len(info.Options) != 6 {
+		t.Errorf("information_type field = %+v", info)
+	}
+	if description := bug.Field("description"); description == nil || !strings.Contains(description.Doc, "\nA detailed description") {
+		t.Errorf("description doc = %q", description.Doc)
+	}
+
+	var names []string
+	for _, op := range bug.Operations {
+		names = append(names, op.Method+" "+op.Name)
+	}
+	if got := strings.Join(names, ", "); got != "POST addAttachment, GET isUserAffected, POST markAsDuplicate, POST newMessage" {
+		t.Errorf("bug operations = %s", got)
+	}
+
+	addAttachment := bug.Operation("addAttachment")
+	if !addAttachment.Multipart || addAttachment.Creates != "bug_attachment" {
+		t.Errorf("addAttachment = %+v", addAttachment)
+	}
+	if data := addAttachment.Param("data"); data == nil || !data.Required || data.Type != "binary" {
+		t.Errorf("data param = %+v", data)
+	}
+	if isPatch := addAttachment.Param("is_patch"); isPatch == nil || isPatch.Required || isPatch.Type != "boolean" {
+		t.Errorf("is_patch param = %+v", isPatch)
+	}
+	if addAttachment.Param("ws.op") != nil {
+		t.Error("ws.op should not be listed as a parameter")
+	}
+	if duplicate := bug.Operation("markAsDuplicate").Param("duplicate_of"); duplicate.Type != "link" || duplicate.LinkType != "bug" {
+		t.Errorf("duplicate_of param = %+v", duplicate)
+	}
+
+	searchTasks := w.ResourceType("distribution").Operation("searchTasks")
+	if searchTasks.Method != "GET" || searchTasks.Returns != "bug_task" || !searchTasks.ReturnsCollection {
+		t.Errorf("searchTasks = %+v", searchTasks)
+	}
+	if status := searchTasks.Param("status"); len(status.Options) != 14 || status.Options[11] != "Fix Released" {
+		t.Errorf("status options = %v", status.Options)
+	}
+
+	if bugs := w.ResourceType("bugs"); !bugs.IsCollection() || bugs.Entries != "bug" || bugs.Operation("createBug").Creates != "bug" {
+		t.Errorf("bugs = %+v", bugs)
+	}
+	if getByEmail := w.ResourceType("people").Operation("getByEmail"); getByEmail.Returns != "person" || getByEmail.ReturnsCollection {
+		t.Errorf("getByEmail = %+v", getByEmail)
+	}
+}
+
+func TestParseWADL_invalid(t *testing.T) {
+	for _, doc := range []string{"", "<html><body>Not WADL</body></html>", "{}"} {
+		if _, err := ParseWADL(strings.NewReader(doc)); err == nil {
+			t.Errorf("ParseWADL(%q) expected error", doc)
+		}
+	}
+}
+
+func TestWADLCachePath(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/cache")
+	got, err := wadlCachePath("https://api.staging.launchpad.net/devel/")
+	if err != nil {
+		t.Fatalf("wadlCachePath() error = %v", err)
+	}
+	if want := "/tmp/cache/lp-api/wadl/api.staging.launchpad.net-devel.xml"; got != want {
+		t.Errorf("wadlCachePath() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadWADL(t *testing.T) {
+	wadl, err := os.ReadFile("testdata/wadl-devel.xml")
+	if err != nil {
+		t.Fatalf("Failed to read WADL: %v", err)
+	}
+	fetches := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if fail {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Accept") != "application/vnd.sun.wadl+xml" {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		w.Write(wadl)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	backup := lpAPI
+	lpAPI = server.URL + "/devel/"
+	t.Cleanup(func() {
+		lpAPI = backup
+		delete(loadedWADL, server.URL+"/devel/")
+	})
+
+	lp := LaunchpadAPI{}
+	load := func() *WADL {
+		t.Helper()
+		delete(loadedWADL, lpAPI)
+		w, err := lp.LoadWADL()
+		if err != nil {
+			t.Fatalf("LoadWADL() error = %v", err)
+		}
+		return w
+	}
+
+	if w := load(); w.ResourceType("bug") == nil || fetches != 1 {
+		t.Fatalf("first load fetched %d times", fetches)
+	}
+	cachePath, _ := wadlCachePath(lpAPI)
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Errorf("WADL was not cached: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(cachePath), ".wadl-*")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	load()
+	if fetches != 1 {
+		t.Errorf("fresh cache was fetched again, %d fetches", fetches)
+	}
+
+	old := time.Now().Add(-*wadlExpiry - time.Hour)
+	os.Chtimes(cachePath, old, old)
+	load()
+	if fetches != 2 {
+		t.Errorf("expired cache was not fetched again, %d fetches", fetches)
+	}
+
+	os.Chtimes(cachePath, old, old)
+	fail = true
+	if w := load(); w.ResourceType("bug") == nil {
+		t.Error("stale cache was not used when Launchpad failed")
+	}
+
+	os.Remove(cachePath)
+	delete(loadedWADL, lpAPI)
+	if _, err := lp.LoadWADL(); err == nil {
+		t.Error("LoadWADL() expected error without cache and with Launchpad failing")
+	}
+
+	// Something that isn't WADL is never cached
+	fail = false
+	wadl = []byte(`{"total_size": 0}`)
+	if _, err := lp.LoadWADL(); err == nil {
+		t.Error("LoadWADL() expected error for an invalid WADL")
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Errorf("invalid WADL was cached: %v", err)
+	}
+}